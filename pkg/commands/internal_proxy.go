@@ -13,6 +13,7 @@ import (
 	"github.com/yhlooo/kubectl-cache/pkg/commands/options"
 	"github.com/yhlooo/kubectl-cache/pkg/proxy"
 	"github.com/yhlooo/kubectl-cache/pkg/proxymgr"
+	"github.com/yhlooo/kubectl-cache/pkg/utils/cmdutil"
 )
 
 // NewInternalProxyCommandWithOptions 基于选项创建 internal-proxy 子命令
@@ -36,8 +37,13 @@ func NewInternalProxyCommandWithOptions(opts *options.InternalProxyOptions) *cob
 			if err != nil {
 				return err
 			}
+			cacheOpts, err := newCacheOptions(globalOpts)
+			if err != nil {
+				return err
+			}
 
-			mgr := proxymgr.NewProxyManager(globalOpts.DataRoot, nil)
+			// 与启动代理的命令使用相同的缓存参数计算签名
+			mgr := proxymgr.NewProxyManager(globalOpts.DataRoot, nil, cmdutil.GetCacheArgs(globalOpts))
 
 			// 锁
 			proxyObj, err := mgr.LockProxy(ctx, config)
@@ -63,6 +69,7 @@ func NewInternalProxyCommandWithOptions(opts *options.InternalProxyOptions) *cob
 				APIProxy: proxy.APIProxyServerOptions{
 					URIPrefix: "/",
 				},
+				Cache:       cacheOpts,
 				MaxIdleTime: opts.MaxIdleTime,
 			})
 			if err != nil {
@@ -3,18 +3,23 @@ package options
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/pflag"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/util/homedir"
 )
 
+// DefaultInformerIdleTTL 默认的 informer 最大空闲时间
+const DefaultInformerIdleTTL = 30 * time.Minute
+
 // NewDefaultGlobalOptions 返回默认全局选项
 func NewDefaultGlobalOptions() GlobalOptions {
 	return GlobalOptions{
-		Verbosity:    0,
-		ClientConfig: genericclioptions.NewConfigFlags(true),
-		DataRoot:     filepath.Join(homedir.HomeDir(), ".kube"),
+		Verbosity:       0,
+		ClientConfig:    genericclioptions.NewConfigFlags(true),
+		DataRoot:        filepath.Join(homedir.HomeDir(), ".kube"),
+		InformerIdleTTL: DefaultInformerIdleTTL,
 	}
 }
 
@@ -26,6 +31,26 @@ type GlobalOptions struct {
 	Verbosity uint32
 	// 数据存储根目录
 	DataRoot string
+	// 是否一致性读（从缓存读取前确保缓存已追上 APIServer ）
+	ConsistentRead bool
+	// 自定义字段索引配置文件路径（见 proxy.FieldIndexConfig ）
+	FieldIndexConfig string
+	// 仅缓存元数据的资源，格式为 <resource>[.<group>]
+	MetadataOnlyResources []string
+	// 缓存的命名空间，为空时缓存所有命名空间
+	CacheNamespaces []string
+	// informer 的最大空闲时间，超过后停止该 informer 以释放内存
+	InformerIdleTTL time.Duration
+	// 缓存估算的最大内存占用，格式与 Kubernetes 资源数量一致（比如 512Mi ），为空时不限制
+	MaxCacheMemory string
+	// 是否从缓存的对象中去掉 metadata.managedFields
+	StripManagedFields bool
+	// 从缓存的对象中去掉的注解
+	StripAnnotations []string
+	// 从缓存的对象中去掉的字段（ JSONPath ）
+	StripFields []string
+	// 缓存的对象被裁剪时，是否将获取单个完整对象的请求直连 APIServer
+	PassthroughFullObjectGets bool
 }
 
 // Validate 校验选项是否合法
@@ -41,4 +66,14 @@ func (o *GlobalOptions) AddPFlags(flags *pflag.FlagSet) {
 	o.ClientConfig.AddFlags(flags)
 	flags.Uint32VarP(&o.Verbosity, "v", "v", o.Verbosity, "Number for the log level verbosity (0, 1, or 2)")
 	flags.StringVar(&o.DataRoot, "data-root", o.DataRoot, "Path to data directory")
+	flags.StringVar(&o.FieldIndexConfig, "field-index-config", o.FieldIndexConfig, "Path to a YAML or JSON file declaring extra fields (as JSONPath) to index per resource kind, so they can be used in field selectors when served from cache")
+	flags.StringSliceVar(&o.MetadataOnlyResources, "metadata-only", o.MetadataOnlyResources, "Resources (in the form resource[.group], e.g. configmaps,secrets,deployments.apps) for which only object metadata is cached to save memory. Requests for full objects of these resources are forwarded to the APIServer")
+	flags.StringSliceVar(&o.CacheNamespaces, "cache-namespaces", o.CacheNamespaces, "Namespaces (e.g. team-a,team-b) in which namespaced resources are cached with namespace-scoped informers, for users without cluster-wide list and watch permissions. Requests across or outside these namespaces are forwarded to the APIServer. If not set, all namespaces are cached, falling back to the namespace of the request when cluster-wide access is forbidden")
+	flags.DurationVar(&o.InformerIdleTTL, "informer-idle-ttl", o.InformerIdleTTL, "Stop the informer (and free the memory) of a resource that has not been read from cache for this long. It is restarted the next time the resource is read. (0 means never)")
+	flags.StringVar(&o.MaxCacheMemory, "max-cache-memory", o.MaxCacheMemory, "Max estimated memory (e.g. 512Mi) used by the cache. When exceeded, the least recently used informers are stopped and their resources are forwarded to the APIServer for a while. If not set, there is no limit")
+	flags.BoolVar(&o.StripManagedFields, "strip-managed-fields", o.StripManagedFields, "If true, strip metadata.managedFields from cached objects to save memory")
+	flags.StringSliceVar(&o.StripAnnotations, "strip-annotations", o.StripAnnotations, "Annotations (e.g. kubectl.kubernetes.io/last-applied-configuration) to strip from cached objects to save memory")
+	flags.StringSliceVar(&o.StripFields, "strip-fields", o.StripFields, "Fields (as JSONPath with only field names and [*], e.g. .status.images,.spec.containers[*].env) to strip from cached objects to save memory")
+	flags.BoolVar(&o.PassthroughFullObjectGets, "passthrough-full-object-gets", o.PassthroughFullObjectGets, "If true and cached objects are stripped, forward requests getting a single full object (e.g. kubectl get -o yaml) to the APIServer, so that the object is not stripped")
+	flags.BoolVar(&o.ConsistentRead, "consistent-read", o.ConsistentRead, "If true, make sure the cache has caught up with the APIServer before reading from it, so that results are as fresh as reading from the APIServer directly")
 }
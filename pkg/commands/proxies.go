@@ -29,7 +29,7 @@ func NewProxiesCommandWithOptions(opts *options.ProxiesOptions) *cobra.Command {
 			ctx := cmd.Context()
 			logger := logr.FromContextOrDiscard(ctx)
 			globalOpts := options.GlobalOptionsFromContext(ctx)
-			mgr := proxymgr.NewProxyManager(globalOpts.DataRoot, nil)
+			mgr := proxymgr.NewProxyManager(globalOpts.DataRoot, nil, nil)
 
 			var ret runtime.Object
 			var err error
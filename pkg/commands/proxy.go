@@ -7,6 +7,8 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	kubectlproxy "k8s.io/kubectl/pkg/proxy"
 
 	"github.com/yhlooo/kubectl-cache/pkg/commands/options"
@@ -57,6 +59,10 @@ remote Kubernetes API server port, except for the path matching the static conte
 			if err != nil {
 				return err
 			}
+			cacheOpts, err := newCacheOptions(globalOpts)
+			if err != nil {
+				return err
+			}
 
 			// 处理过滤选项
 			var filter *kubectlproxy.FilterServer
@@ -96,6 +102,7 @@ remote Kubernetes API server port, except for the path matching the static conte
 					Keepalive:          opts.Keepalive,
 					AppendLocationPath: opts.AppendServerPath,
 				},
+				Cache: cacheOpts,
 				Static: proxy.StaticServerOptions{
 					URIPrefix: opts.WWWPrefix,
 					FileBase:  opts.WWW,
@@ -118,3 +125,36 @@ remote Kubernetes API server port, except for the path matching the static conte
 
 	return cmd
 }
+
+// newCacheOptions 基于全局选项创建代理缓存选项
+func newCacheOptions(globalOpts options.GlobalOptions) (proxy.CacheOptions, error) {
+	opts := proxy.CacheOptions{
+		ConsistentRead: globalOpts.ConsistentRead,
+	}
+	if globalOpts.FieldIndexConfig != "" {
+		fieldIndexes, err := proxy.LoadFieldIndexConfig(globalOpts.FieldIndexConfig)
+		if err != nil {
+			return opts, err
+		}
+		opts.FieldIndexes = fieldIndexes
+	}
+	for _, resource := range globalOpts.MetadataOnlyResources {
+		opts.MetadataOnly = append(opts.MetadataOnly, schema.ParseGroupResource(resource))
+	}
+	opts.Namespaces = globalOpts.CacheNamespaces
+	opts.InformerIdleTTL = globalOpts.InformerIdleTTL
+	if globalOpts.MaxCacheMemory != "" {
+		maxMemory, err := resource.ParseQuantity(globalOpts.MaxCacheMemory)
+		if err != nil {
+			return opts, fmt.Errorf("invalid max cache memory %q: %w", globalOpts.MaxCacheMemory, err)
+		}
+		opts.MaxMemory = maxMemory.Value()
+	}
+	opts.Transform = proxy.TransformOptions{
+		StripManagedFields:        globalOpts.StripManagedFields,
+		StripAnnotations:          globalOpts.StripAnnotations,
+		StripFields:               globalOpts.StripFields,
+		PassthroughFullObjectGets: globalOpts.PassthroughFullObjectGets,
+	}
+	return opts, nil
+}
@@ -19,7 +19,7 @@ func NewShutdownCommandWithOptions(opts *options.ShutdownOptions) *cobra.Command
 			ctx := cmd.Context()
 			logger := logr.FromContextOrDiscard(ctx)
 			globalOpts := options.GlobalOptionsFromContext(ctx)
-			mgr := proxymgr.NewProxyManager(globalOpts.DataRoot, nil)
+			mgr := proxymgr.NewProxyManager(globalOpts.DataRoot, nil, nil)
 
 			// 获取需要关闭的代理列表
 			var proxies []proxymgr.Proxy
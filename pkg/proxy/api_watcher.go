@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// apiRediscoverInterval 无法监听 CustomResourceDefinition 或 APIService 时定期通知 API 变化的间隔
+const apiRediscoverInterval = 10 * time.Minute
+
+var (
+	// crdGVR CustomResourceDefinition 资源
+	crdGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	// apiServiceGVR APIService 资源
+	apiServiceGVR = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+)
+
+// APIChangeEvent API 变化事件
+type APIChangeEvent struct {
+	// 变化的对象类型， CustomResourceDefinition 或 APIService
+	Resource schema.GroupResource
+	// 变化的对象名，比如 foos.example.com 或 v1.example.com 。无法监听该类型对象而定期通知时为空
+	Name string
+	// 对象是否被删除
+	Deleted bool
+}
+
+// APIWatcher 监听 CustomResourceDefinition 和 APIService 的变化，在 APIServer 提供的 API 变化时通知
+type APIWatcher struct {
+	lock     sync.RWMutex
+	handlers []func(event APIChangeEvent)
+}
+
+// NewAPIWatcherForConfig 基于客户端配置创建并启动 APIWatcher
+//
+// 只监听元数据，忽略初始列表中的对象和未变化的（重新同步的）对象
+func NewAPIWatcherForConfig(ctx context.Context, config *rest.Config) (*APIWatcher, error) {
+	client, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("create metadata client error: %w", err)
+	}
+	return newAPIWatcher(ctx, client, apiRediscoverInterval)
+}
+
+// newAPIWatcher 基于 metadata 客户端创建并启动 APIWatcher
+//
+// 没有权限列出（或 APIServer 不提供） CustomResourceDefinition 或 APIService 时不监听该类型对象，
+// 否则 informer 会一直重试。改为每隔 rediscoverInterval 通知一次该类型对象变化，使 discovery 缓存等定期刷新，
+// 在此之前新安装的资源由 DynamicRESTMapper 在找不到资源时重新发现
+func newAPIWatcher(ctx context.Context, client metadata.Interface, rediscoverInterval time.Duration) (*APIWatcher, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	w := &APIWatcher{}
+	factory := metadatainformer.NewSharedInformerFactory(client, time.Hour)
+	var unwatched []schema.GroupResource
+	for _, gvr := range []schema.GroupVersionResource{crdGVR, apiServiceGVR} {
+		gr := gvr.GroupResource()
+		if err := probeAPIResource(ctx, client, gvr); err != nil {
+			logger.Info(fmt.Sprintf("can not watch %s, rediscover APIs every %s instead: %v", gr, rediscoverInterval, err))
+			unwatched = append(unwatched, gr)
+			continue
+		}
+		_, err := factory.ForResource(gvr).Informer().AddEventHandler(toolscache.ResourceEventHandlerDetailedFuncs{
+			AddFunc: func(obj interface{}, isInInitialList bool) {
+				if !isInInitialList {
+					w.notify(gr, obj, false)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldMeta, oldOK := oldObj.(*metav1.PartialObjectMetadata)
+				newMeta, newOK := newObj.(*metav1.PartialObjectMetadata)
+				if oldOK && newOK && oldMeta.ResourceVersion == newMeta.ResourceVersion {
+					return
+				}
+				w.notify(gr, newObj, false)
+			},
+			DeleteFunc: func(obj interface{}) {
+				w.notify(gr, obj, true)
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("add event handler for %s error: %w", gr, err)
+		}
+		logger.V(1).Info(fmt.Sprintf("watching %s", gr))
+	}
+	factory.Start(ctx.Done())
+	if len(unwatched) > 0 {
+		go wait.Until(func() {
+			for _, gr := range unwatched {
+				w.handle(APIChangeEvent{Resource: gr})
+			}
+		}, rediscoverInterval, ctx.Done())
+	}
+
+	return w, nil
+}
+
+// probeAPIResource 检查能否列出 gvr 资源
+//
+// 仅在没有权限（ 401 、 403 ）或资源不存在（ 404 ）时返回错误，其它错误可能是暂时的，由 informer 重试
+func probeAPIResource(ctx context.Context, client metadata.Interface, gvr schema.GroupVersionResource) error {
+	_, err := client.Resource(gvr).List(ctx, metav1.ListOptions{Limit: 1})
+	if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) || apierrors.IsNotFound(err) {
+		return fmt.Errorf("list %s error: %w", gvr.GroupResource(), err)
+	}
+	return nil
+}
+
+// AddHandler 添加 API 变化事件处理方法
+func (w *APIWatcher) AddHandler(handler func(event APIChangeEvent)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.handlers = append(w.handlers, handler)
+}
+
+// notify 通知对象变化
+func (w *APIWatcher) notify(gr schema.GroupResource, obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	objMeta, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return
+	}
+	w.handle(APIChangeEvent{
+		Resource: gr,
+		Name:     objMeta.Name,
+		Deleted:  deleted,
+	})
+}
+
+// handle 调用所有 API 变化事件处理方法
+func (w *APIWatcher) handle(event APIChangeEvent) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	for _, handler := range w.handlers {
+		handler(event)
+	}
+}
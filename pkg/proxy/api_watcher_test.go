@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// TestAPIWatcherForbidden 测试没有权限列出 CRD 和 APIService 时不监听，改为定期通知
+func TestAPIWatcherForbidden(t *testing.T) {
+	client := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	client.PrependReactor("list", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(action.GetResource().GroupResource(), "", nil)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w, err := newAPIWatcher(ctx, client, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("new api watcher error: %v", err)
+	}
+	events := make(chan APIChangeEvent, 100)
+	w.AddHandler(func(event APIChangeEvent) {
+		select {
+		case events <- event:
+		default:
+		}
+	})
+
+	// 定期通知两种资源的变化
+	received := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			if event.Name != "" || event.Deleted {
+				t.Errorf("unexpected event: %#v", event)
+			}
+			received[event.Resource.String()] = true
+		case <-timeout:
+			t.Fatalf("expected periodic events for crds and apiservices, got: %v", received)
+		}
+	}
+
+	// 只检查过权限，没有启动 informer
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "list" {
+			t.Errorf("expected no %s request, got: %#v", action.GetVerb(), action)
+		}
+	}
+	if n := len(client.Actions()); n != 2 {
+		t.Errorf("expected 2 list requests, got: %d", n)
+	}
+}
+
+// TestAPIWatcherPartiallyForbidden 测试仅没有权限列出 CRD 时仍监听 APIService
+func TestAPIWatcherPartiallyForbidden(t *testing.T) {
+	client := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	client.PrependReactor("list", crdGVR.Resource, func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(action.GetResource().GroupResource(), "", nil)
+	})
+	client.PrependReactor("list", apiServiceGVR.Resource, func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &metav1.List{}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w, err := newAPIWatcher(ctx, client, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("new api watcher error: %v", err)
+	}
+	events := make(chan APIChangeEvent, 100)
+	w.AddHandler(func(event APIChangeEvent) {
+		select {
+		case events <- event:
+		default:
+		}
+	})
+
+	// 仅定期通知 CRD 的变化
+	for i := 0; i < 3; i++ {
+		select {
+		case event := <-events:
+			if event.Resource != crdGVR.GroupResource() {
+				t.Errorf("expected periodic events for %s only, got: %#v", crdGVR.GroupResource(), event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected periodic events for %s", crdGVR.GroupResource())
+		}
+	}
+
+	// 监听 APIService
+	if err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "watch" && action.GetResource() == apiServiceGVR {
+				return true, nil
+			}
+		}
+		return false, nil
+	}); err != nil {
+		t.Errorf("expected watching %s, got actions: %v", apiServiceGVR.GroupResource(), client.Actions())
+	}
+}
@@ -5,13 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"slices"
-	"sort"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	listersapiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metascheme "k8s.io/apimachinery/pkg/apis/meta/internalversion/scheme"
@@ -21,33 +23,90 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/util/sets"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
 	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// ConsistentReadHeader 请求一致性读的请求头，值为 "true" 时从缓存读取前确保缓存已追上 APIServer
+const ConsistentReadHeader = "X-Kubectl-Cache-Consistent-Read"
+
+// errPassthrough 缓存无法满足请求，需要直连 APIServer 处理
+var errPassthrough = errors.New("request can not be served from cache")
+
+// CacheOptions 缓存选项
+type CacheOptions struct {
+	// 是否对所有读请求进行一致性读
+	//
+	// 一致性读时先从 APIServer 获取当前的资源版本，等待缓存追上该资源版本后再从缓存读取，
+	// 使结果与直接读 APIServer 一样新，等待超时则直连。未开启时也可以通过 ConsistentReadHeader 请求头对单个请求开启
+	ConsistentRead bool
+	// 用户自定义的各类型额外字段索引（见 LoadFieldIndexConfig ）
+	//
+	// 字段名为去掉开头 "." 的 JSONPath ，索引后可用于从缓存读取时的字段选择器
+	FieldIndexes map[schema.GroupVersionKind][]apiextensionsv1.SelectableField
+	// 仅缓存元数据的资源
+	//
+	// 这些资源通过 PartialObjectMetadata informer 缓存，只能从缓存返回表格或 PartialObjectMetadata 格式的结果，
+	// 请求完整对象时直连 APIServer ，用于减少对象很大或很多的资源（比如 ConfigMap 、 Secret ）占用的内存
+	MetadataOnly []schema.GroupResource
+	// 缓存的命名空间
+	//
+	// 设置后命名空间级资源仅在这些命名空间中建立 informer ，跨命名空间或其它命名空间的请求直连 APIServer ，
+	// 用于没有跨命名空间列出资源权限的用户。未设置时缓存所有命名空间，但没有跨命名空间权限时按请求的命名空间建立 informer
+	Namespaces []string
+	// informer 的最大空闲时间
+	//
+	// 超过该时间未被使用（且没有进行中的 watch ）的 informer 会被停止以释放内存，再次使用时重新建立。为 0 时不停止
+	InformerIdleTTL time.Duration
+	// 缓存估算的最大内存占用（字节）
+	//
+	// 超过时按最近最少使用的顺序停止 informer ，对应资源在冷却时间内直连 APIServer 。为 0 时不限制
+	MaxMemory int64
+	// 缓存对象前对其进行的裁剪
+	Transform TransformOptions
+}
+
 // NewCacheProxyHandler 创建一个缓存代理 HTTP 处理器
+//
+// 缓存无法满足的请求（比如请求的资源版本缓存中没有）交给 passthrough 处理。
+// apiWatcher 不为空时， API 变化后清空 discovery 缓存，并停止已删除的 CRD 定义的资源的 informer
 func NewCacheProxyHandler(
 	ctx context.Context,
 	config *rest.Config,
 	mapper meta.RESTMapper,
+	apiWatcher *APIWatcher,
 	apiProxyPrefix string,
+	passthrough http.Handler,
+	opts CacheOptions,
 ) (*CacheProxyHandler, error) {
 	logger := logr.FromContextOrDiscard(ctx)
 
 	scheme := runtime.NewScheme()
 	AddKubernetesTypesToScheme(scheme)
 
+	transform, err := NewObjectTransform(opts.Transform)
+	if err != nil {
+		return nil, fmt.Errorf("create object transform error: %w", err)
+	}
+
 	syncPeriod := 10 * time.Minute
-	c, err := cache.New(config, cache.Options{
-		Scheme:     scheme,
-		Mapper:     mapper,
-		SyncPeriod: &syncPeriod,
-	})
+	cacheOpts := cache.Options{
+		Scheme:           scheme,
+		Mapper:           mapper,
+		SyncPeriod:       &syncPeriod,
+		DefaultTransform: transform,
+	}
+	c, err := cache.New(config, cacheOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -56,16 +115,41 @@ func NewCacheProxyHandler(
 			logger.Error(err, "run cache error")
 		}
 	}()
+	// 仅缓存指定命名空间的 cache.Cache 按需创建
+	newNamespaceCache := func(namespace string) (cache.Cache, error) {
+		namespaceCacheOpts := cacheOpts
+		namespaceCacheOpts.DefaultNamespaces = map[string]cache.Config{namespace: {}}
+		c, err := cache.New(config, namespaceCacheOpts)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			if err := c.Start(ctx); err != nil {
+				logger.Error(err, fmt.Sprintf("run cache for namespace %q error", namespace))
+			}
+		}()
+		return c, nil
+	}
 
 	apisPathPrefix := strings.Trim(strings.Trim(apiProxyPrefix, "/")+"/apis", "/")
 	legacyAPIsPathPrefix := strings.Trim(strings.Trim(apiProxyPrefix, "/")+"/api", "/")
 
-	tableConvertor, err := NewDefaultTableConvertor(config, scheme)
+	crdLister, crdSynced, err := NewCRDListerForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("create table convertor error: %w", err)
+		return nil, fmt.Errorf("create crd lister error: %w", err)
 	}
+	tableConvertor := NewDefaultTableConvertor(scheme, crdLister)
 
-	return &CacheProxyHandler{
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("create metadata client error: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("create discovery client error: %w", err)
+	}
+
+	h := &CacheProxyHandler{
 		scheme: scheme,
 		cache:  c,
 		mapper: mapper,
@@ -74,7 +158,33 @@ func NewCacheProxyHandler(
 			GrouplessAPIPrefixes: sets.NewString(legacyAPIsPathPrefix),
 		},
 		tableConvertor: tableConvertor,
-	}, nil
+		crdLister:      crdLister,
+		crdSynced:      crdSynced,
+		passthrough:    passthrough,
+		metadataClient: metadataClient,
+		discovery:      memory.NewMemCacheClient(discoveryClient),
+		consistentRead: opts.ConsistentRead,
+		fieldIndexes:   opts.FieldIndexes,
+		metadataOnly:   newMetadataOnlyResources(mapper, opts.MetadataOnly),
+		namespaces:     sets.New(opts.Namespaces...),
+		serializers:    serializer.NewCodecFactory(scheme).SupportedMediaTypes(),
+		// 与客户端配置一致，禁用压缩时不压缩响应
+		disableCompression: config.DisableCompression,
+		newNamespaceCache:  newNamespaceCache,
+		informerIdleTTL:    opts.InformerIdleTTL,
+		maxMemory:          opts.MaxMemory,
+		// 对象被裁剪过时才需要直连
+		passthroughFullObjectGets: transform != nil && opts.Transform.PassthroughFullObjectGets,
+	}
+	if apiWatcher != nil {
+		apiWatcher.AddHandler(func(event APIChangeEvent) {
+			h.handleAPIChange(ctx, event)
+		})
+	}
+	if opts.InformerIdleTTL > 0 || opts.MaxMemory > 0 {
+		go h.runInformerEviction(ctx)
+	}
+	return h, nil
 }
 
 // CacheProxyHandler 缓存代理 HTTP 处理器
@@ -84,76 +194,208 @@ type CacheProxyHandler struct {
 	mapper         meta.RESTMapper
 	resolver       apirequest.RequestInfoResolver
 	tableConvertor registryrest.TableConvertor
+	crdLister      listersapiextensionsv1.CustomResourceDefinitionLister
+	crdSynced      toolscache.InformerSynced
+	passthrough    http.Handler
+	metadataClient metadata.Interface
+	discovery      discovery.DiscoveryInterface
+	consistentRead bool
+	fieldIndexes   map[schema.GroupVersionKind][]apiextensionsv1.SelectableField
+	metadataOnly   sets.Set[schema.GroupResource]
+	serializers    []runtime.SerializerInfo
+	writes         writeTracker
+	fallbacks      passthroughResources
+
+	disableCompression bool
+	informerIdleTTL    time.Duration
+	maxMemory          int64
 
-	startedInformersLock sync.RWMutex
-	startedInformers     map[schema.GroupVersionResource]bool
+	passthroughFullObjectGets bool
+
+	// 缓存的命名空间，为空时缓存所有命名空间
+	namespaces sets.Set[string]
+	// 创建仅缓存指定命名空间的 cache.Cache
+	newNamespaceCache func(namespace string) (cache.Cache, error)
+
+	watchCachesLock sync.RWMutex
+	watchCaches     map[watchCacheKey]*watchCache
+	// 启动中的 informer
+	startingInformers map[watchCacheKey]*informerStart
+	// 各命名空间的 cache.Cache
+	namespaceCaches map[string]cache.Cache
 }
 
 var _ http.Handler = &CacheProxyHandler{}
 
 // ServeHTTP 处理 HTTP 请求
 func (h *CacheProxyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	ret, err := h.Handle(req)
+	if info, err := h.resolver.NewRequestInfo(req); err == nil && info.Verb == "watch" {
+		h.ServeWatch(w, req)
+		return
+	}
+
+	creq, err := h.prepareRequest(req)
 	if err != nil {
-		logr.FromContextOrDiscard(req.Context()).Error(err, "handle request error")
-		var apierr *apierrors.StatusError
-		if errors.As(err, &apierr) {
-			WriteResponse(w, int(apierr.Status().Code), apierr.Status())
-			return
-		}
-		WriteResponse(w, http.StatusInternalServerError, apierrors.NewInternalError(err).Status())
+		h.writeError(w, req, err)
+		return
+	}
+	if creq.info.Verb == "list" && creq.serializer.MediaType == runtime.ContentTypeJSON {
+		// JSON 格式的列表逐个对象流式编码，避免拷贝整个列表
+		h.serveListStream(w, req, creq)
+		return
+	}
+	ret, err := h.handle(req, creq)
+	if err != nil {
+		h.writeError(w, req, err)
+		return
+	}
+	h.writeResponse(w, req, http.StatusOK, ret)
+}
+
+// writeError 将错误写到响应，缓存无法满足的请求（ errPassthrough ）交给直连处理
+func (h *CacheProxyHandler) writeError(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, errPassthrough) && h.passthrough != nil {
+		// 缓存无法满足，直连
+		logr.FromContextOrDiscard(req.Context()).V(1).Info(fmt.Sprintf(
+			"PASSTHROUGH %s %s: %v", req.Method, req.RequestURI, err,
+		))
+		h.passthrough.ServeHTTP(w, req)
+		return
+	}
+	logr.FromContextOrDiscard(req.Context()).Error(err, "handle request error")
+	status := apierrors.NewInternalError(err).Status()
+	var apierr *apierrors.StatusError
+	if errors.As(err, &apierr) {
+		status = apierr.Status()
+	}
+	status.APIVersion = "v1"
+	status.Kind = "Status"
+	h.writeResponse(w, req, int(status.Code), &status)
+}
+
+// writeResponse 以请求协商得到的媒体类型编码对象并写到响应
+//
+// 协商失败或对象不支持以协商得到的媒体类型编码时使用 JSON 。客户端接受 gzip 且响应超过阈值时压缩
+func (h *CacheProxyHandler) writeResponse(w http.ResponseWriter, req *http.Request, code int, obj runtime.Object) {
+	_, isUnstructured := obj.(runtime.Unstructured)
+	info, _, _ := negotiateResponse(req, h.serializers, meta.IsListType(obj), !isUnstructured)
+	raw, contentType, err := encodeResponse(h.serializers, info, obj)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	WriteResponse(w, http.StatusOK, ret)
+
+	w, closeWriter := h.newResponseWriter(w, req)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	_, _ = w.Write(raw)
+	if err := closeWriter(); err != nil {
+		logr.FromContextOrDiscard(req.Context()).Error(err, "write response error")
+	}
+}
+
+// cacheRequest 经过解析和协商的缓存请求
+type cacheRequest struct {
+	info *apirequest.RequestInfo
+	gvr  schema.GroupVersionResource
+	gvk  schema.GroupVersionKind
+	wc   *watchCache
+
+	// 协商得到的序列化器
+	serializer runtime.SerializerInfo
+	// 协商得到的响应类型，不要求转换时为空
+	target schema.GroupVersionKind
+	// 用于转换为表格
+	tableConvertor registryrest.TableConvertor
+	// 表格选项，响应类型为表格时有效
+	tableOptions *metav1.TableOptions
+}
+
+// newRequestObject 创建请求对应的空对象或列表，仅缓存了元数据时为 PartialObjectMetadata 或 PartialObjectMetadataList
+func (h *CacheProxyHandler) newRequestObject(creq *cacheRequest, isList bool) runtime.Object {
+	if creq.wc.metadataOnly {
+		return newPartialObjectMetadata(creq.gvk, isList)
+	}
+	return h.newObject(creq.gvk, isList)
 }
 
 // Handle 处理请求
 func (h *CacheProxyHandler) Handle(req *http.Request) (runtime.Object, error) {
+	creq, err := h.prepareRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return h.handle(req, creq)
+}
+
+// prepareRequest 解析请求、协商响应类型并设置 informer
+func (h *CacheProxyHandler) prepareRequest(req *http.Request) (*cacheRequest, error) {
 	ctx := req.Context()
-	logger := logr.FromContextOrDiscard(ctx)
 
 	// 检查请求
-	info, err := h.resolver.NewRequestInfo(req)
+	info, gvr, gvk, err := h.resolveRequest(req)
 	if err != nil {
-		return nil, fmt.Errorf("resolve request error: %w", err)
+		return nil, err
 	}
-	gvr := schema.GroupVersionResource{
-		Group:    info.APIGroup,
-		Version:  info.APIVersion,
-		Resource: info.Resource,
+	serializer, target, err := negotiateResponse(req, h.serializers, info.Verb == "list", h.scheme.Recognizes(gvk))
+	if err != nil {
+		return nil, err
 	}
-	if info.Subresource != "" && info.Subresource != "status" {
-		gvr.Resource = info.Resource + "/" + info.Subresource
-		return nil, apierrors.NewMethodNotSupported(gvr.GroupResource(), info.Verb)
+	var tableOptions *metav1.TableOptions
+	if target.Kind == kindTable {
+		if tableOptions, err = ParseTableOptions(req); err != nil {
+			return nil, err
+		}
 	}
-	// 获取请求对应资源 Kind
-	gvk, err := h.mapper.KindFor(gvr)
-	if err != nil || gvk.Version != gvr.Version || gvk.Group != gvr.Group {
-		return nil, &apierrors.StatusError{ErrStatus: metav1.Status{
-			Code:   http.StatusNotFound,
-			Reason: metav1.StatusReasonNotFound,
-		}}
+	if info.Subresource == statusSubresource {
+		// 与 APIServer 一致，返回完整的对象，但资源需要有 status 子资源
+		ok, err := h.hasSubresource(ctx, gvr, gvk, statusSubresource)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, newSubresourceNotFoundError(gvr, statusSubresource)
+		}
 	}
-	if info.Verb == "list" {
-		gvk.Kind += "List"
+
+	if h.passthroughFullObjectGets && info.Verb == "get" && target.Kind == "" && info.Subresource != scaleSubresource {
+		// 缓存的对象被裁剪过，获取完整对象时直连
+		return nil, fmt.Errorf("%w: cached objects of %s are transformed", errPassthrough, gvr.GroupResource())
 	}
 
 	// 设置 informer
-	if err := h.ensureInformer(ctx, gvr); err != nil {
+	wc, err := h.ensureInformer(ctx, gvr, info.Namespace)
+	if err != nil {
 		return nil, fmt.Errorf("ensure informer for %s error: %w", gvr, err)
 	}
 
-	// 创建返回对象
-	obj, err := h.scheme.New(gvk)
-	if err != nil {
-		// 无结构对象
-		if info.Verb == "list" {
-			obj = &unstructured.UnstructuredList{}
-		} else {
-			obj = &unstructured.Unstructured{}
+	creq := &cacheRequest{
+		info:           info,
+		gvr:            gvr,
+		gvk:            gvk,
+		wc:             wc,
+		serializer:     serializer,
+		target:         target,
+		tableConvertor: h.tableConvertor,
+		tableOptions:   tableOptions,
+	}
+	if wc.metadataOnly {
+		// 仅缓存了元数据，只能返回表格或 PartialObjectMetadata 格式的结果
+		if info.Subresource == scaleSubresource || !servableFromMetadata(target, tableOptions) {
+			return nil, fmt.Errorf("%w: only metadata of %s is cached", errPassthrough, gvr.GroupResource())
 		}
+		creq.tableConvertor = registryrest.NewDefaultTableConvertor(gvr.GroupResource())
 	}
-	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return creq, nil
+}
+
+// handle 处理经过解析的请求
+func (h *CacheProxyHandler) handle(req *http.Request, creq *cacheRequest) (runtime.Object, error) {
+	ctx := req.Context()
+	info, gvr, wc := creq.info, creq.gvr, creq.wc
+
+	// 创建返回对象
+	obj := h.newRequestObject(creq, info.Verb == "list")
 
 	switch info.Verb {
 	case "get":
@@ -165,9 +407,19 @@ func (h *CacheProxyHandler) Handle(req *http.Request) (runtime.Object, error) {
 		if !ok {
 			return nil, fmt.Errorf("%T is not a client.Object", ret)
 		}
-		if err := h.HandleGet(ctx, ret, info.Namespace, info.Name, opts); err != nil {
+		if opts.ResourceVersion == "" {
+			if err := h.waitForLatest(ctx, req, wc, gvr, info.Namespace); err != nil {
+				return nil, err
+			}
+		}
+		if err := h.HandleGet(ctx, gvr, ret, info.Namespace, info.Name, opts); err != nil {
 			return nil, err
 		}
+		if info.Subresource == scaleSubresource {
+			if obj, err = h.scaleFromObject(ctx, gvr, ret); err != nil {
+				return nil, err
+			}
+		}
 	case "list":
 		opts, err := ParseListOptions(req)
 		if err != nil {
@@ -177,29 +429,66 @@ func (h *CacheProxyHandler) Handle(req *http.Request) (runtime.Object, error) {
 		if !ok {
 			return nil, fmt.Errorf("%T is not a client.ObjectList", ret)
 		}
-		if err := h.HandleList(ctx, ret, info.Namespace, opts); err != nil {
-			return nil, err
+		if opts.ResourceVersion == "" && opts.Continue == "" {
+			if err := h.waitForLatest(ctx, req, wc, gvr, info.Namespace); err != nil {
+				return nil, err
+			}
 		}
-		if err := sortObjectsByNamespaceName(obj); err != nil {
-			logger.Info("WARNING sort objects by namespace and name error: %v", err)
+		if err := h.HandleList(ctx, gvr, ret, info.Namespace, opts); err != nil {
+			return nil, err
 		}
 	default:
 		return nil, apierrors.NewMethodNotSupported(gvr.GroupResource(), info.Verb)
 	}
 
-	// 转为列表
-	accept := strings.Split(req.Header.Get("Accept"), ",")
-	if !slices.Contains(accept, "application/json;as=Table;v=v1;g=meta.k8s.io") || h.tableConvertor == nil {
-		// 不支持服务端表格，返回普通 json 格式
-		return obj, nil
+	// 转为请求的类型
+	return transformResponseObject(ctx, creq.tableConvertor, creq.tableOptions, obj, creq.target)
+}
+
+// waitForLatest 在读取最新数据（ resourceVersion 为空）前等待缓存足够新
+//
+// 缓存至少要追上经代理转发的写请求返回的资源版本（读己之写），一致性读时还要追上 APIServer 当前的资源版本
+func (h *CacheProxyHandler) waitForLatest(
+	ctx context.Context,
+	req *http.Request,
+	wc *watchCache,
+	gvr schema.GroupVersionResource,
+	namespace string,
+) error {
+	if h.isConsistentRead(req) {
+		return h.waitForConsistentRead(ctx, wc, gvr, namespace)
 	}
-	table, err := ConvertToTable(ctx, h.tableConvertor, obj)
-	if err != nil {
-		logger.V(1).Info(fmt.Sprintf("convert to table error: %v", err))
-		return obj, nil
+	rv := h.writes.ResourceVersion(gvr.GroupResource(), namespace, wc.writeSeq)
+	return waitForResourceVersion(ctx, wc, formatResourceVersion(rv))
+}
+
+// isConsistentRead 判断请求是否需要一致性读
+func (h *CacheProxyHandler) isConsistentRead(req *http.Request) bool {
+	if h.consistentRead {
+		return true
 	}
+	consistent, _ := strconv.ParseBool(req.Header.Get(ConsistentReadHeader))
+	return consistent
+}
 
-	return table, nil
+// waitForConsistentRead 从 APIServer 获取资源当前的资源版本，并等待缓存追上该资源版本
+//
+// 与 APIServer 从 watch 缓存进行一致性读一致，通过 limit=1 的列表请求获取当前资源版本。
+// 获取失败或等待超时（比如资源最近没有写入，缓存收不到推进资源版本的事件）返回 errPassthrough
+func (h *CacheProxyHandler) waitForConsistentRead(
+	ctx context.Context,
+	wc *watchCache,
+	gvr schema.GroupVersionResource,
+	namespace string,
+) error {
+	list, err := h.metadataClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("%w: get current resource version of %s error: %w", errPassthrough, gvr, err)
+	}
+	if _, err := parseResourceVersion(list.GetResourceVersion()); err != nil {
+		return fmt.Errorf("%w: %w", errPassthrough, err)
+	}
+	return waitForResourceVersion(ctx, wc, list.GetResourceVersion())
 }
 
 // IsCached 判断该请求是否有缓存
@@ -214,13 +503,18 @@ func (h *CacheProxyHandler) IsCached(req *http.Request) bool {
 	if info.Resource == "" {
 		return false
 	}
-	// 除 status 以外的子资源都不缓存
-	if info.Subresource != "" && info.Subresource != "status" {
+	// 除 status 和 scale 以外的子资源都不缓存
+	switch info.Subresource {
+	case "", statusSubresource:
+	case scaleSubresource:
+		// scale 子资源只支持获取
+		return info.Verb == "get"
+	default:
 		return false
 	}
 
 	switch info.Verb {
-	case "get", "list":
+	case "get", "list", "watch":
 	default:
 		// 其它请求都不缓存
 		return false
@@ -231,150 +525,684 @@ func (h *CacheProxyHandler) IsCached(req *http.Request) bool {
 	return true
 }
 
+// resolveRequest 解析请求对应的资源
+func (h *CacheProxyHandler) resolveRequest(
+	req *http.Request,
+) (*apirequest.RequestInfo, schema.GroupVersionResource, schema.GroupVersionKind, error) {
+	info, err := h.resolver.NewRequestInfo(req)
+	if err != nil {
+		return nil, schema.GroupVersionResource{}, schema.GroupVersionKind{}, fmt.Errorf("resolve request error: %w", err)
+	}
+	gvr := schema.GroupVersionResource{
+		Group:    info.APIGroup,
+		Version:  info.APIVersion,
+		Resource: info.Resource,
+	}
+	switch info.Subresource {
+	case "", statusSubresource:
+	case scaleSubresource:
+		if info.Verb != "get" {
+			gvr.Resource = info.Resource + "/" + info.Subresource
+			return nil, gvr, schema.GroupVersionKind{}, apierrors.NewMethodNotSupported(gvr.GroupResource(), info.Verb)
+		}
+	default:
+		gvr.Resource = info.Resource + "/" + info.Subresource
+		return nil, gvr, schema.GroupVersionKind{}, apierrors.NewMethodNotSupported(gvr.GroupResource(), info.Verb)
+	}
+	// 获取请求对应资源 Kind
+	gvk, err := h.mapper.KindFor(gvr)
+	if err != nil || gvk.Version != gvr.Version || gvk.Group != gvr.Group {
+		return nil, gvr, gvk, &apierrors.StatusError{ErrStatus: metav1.Status{
+			Code:   http.StatusNotFound,
+			Reason: metav1.StatusReasonNotFound,
+		}}
+	}
+	return info, gvr, gvk, nil
+}
+
+// newObject 创建指定类型的空对象或空列表对象
+func (h *CacheProxyHandler) newObject(gvk schema.GroupVersionKind, isList bool) runtime.Object {
+	if isList {
+		gvk.Kind += "List"
+	}
+	obj, err := h.scheme.New(gvk)
+	if err != nil {
+		// 无结构对象
+		if isList {
+			obj = &unstructured.UnstructuredList{}
+		} else {
+			obj = &unstructured.Unstructured{}
+		}
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return obj
+}
+
 // HandleGet 处理获取对象
+//
+// resourceVersion 为空或 "0" 时返回缓存中的对象，否则等待缓存不旧于该版本，等待超时返回 errPassthrough
 func (h *CacheProxyHandler) HandleGet(
 	ctx context.Context,
+	gvr schema.GroupVersionResource,
 	obj client.Object,
 	namespace, name string,
 	opts metav1.GetOptions,
 ) error {
-	return h.cache.Get(
-		ctx,
-		client.ObjectKey{Namespace: namespace, Name: name},
-		obj,
-		&client.GetOptions{Raw: &opts},
-	)
+	wc, err := h.ensureInformer(ctx, gvr, namespace)
+	if err != nil {
+		return fmt.Errorf("ensure informer for %s error: %w", gvr, err)
+	}
+	if err := waitForResourceVersion(ctx, wc, opts.ResourceVersion); err != nil {
+		return err
+	}
+
+	cached, exists, err := wc.Get(namespace, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return apierrors.NewNotFound(gvr.GroupResource(), name)
+	}
+
+	// 拷贝对象，避免修改缓存
+	cached = cached.DeepCopyObject()
+	outVal := reflect.ValueOf(obj)
+	objVal := reflect.ValueOf(cached)
+	if !objVal.Type().AssignableTo(outVal.Type()) {
+		return fmt.Errorf("cache had type %s, but %s was asked for", objVal.Type(), outVal.Type())
+	}
+	reflect.Indirect(outVal).Set(reflect.Indirect(objVal))
+
+	return nil
 }
 
 // HandleList 处理列出对象
+//
+// 结果按 namespace/name 排序，设置了 limit 时分页返回。
+// resourceVersion 和 resourceVersionMatch 的语义与 APIServer 一致，缓存无法满足时返回 errPassthrough
 func (h *CacheProxyHandler) HandleList(
 	ctx context.Context,
+	gvr schema.GroupVersionResource,
 	obj client.ObjectList,
 	namespace string,
 	opts metav1.ListOptions,
 ) error {
-	// 组装选项
-	listOpts := &client.ListOptions{
-		Namespace: namespace,
-		//Limit:     opts.Limit, // TODO: 暂不支持分页，传递该选项会导致返回结果不完整
-		//Continue:  opts.Continue,
-		Raw: &opts,
+	wc, err := h.ensureInformer(ctx, gvr, namespace)
+	if err != nil {
+		return fmt.Errorf("ensure informer for %s error: %w", gvr, err)
 	}
-	if opts.LabelSelector != "" {
-		selector, err := labels.Parse(opts.LabelSelector)
-		if err != nil {
-			return apierrors.NewBadRequest(err.Error())
-		}
-		listOpts.LabelSelector = selector
+
+	ret, err := h.listFromCache(ctx, wc, namespace, opts)
+	if err != nil {
+		return err
 	}
-	if opts.FieldSelector != "" {
-		selector, err := fields.ParseSelector(opts.FieldSelector)
-		if err != nil {
-			return apierrors.NewBadRequest(err.Error())
+
+	// 拷贝对象，避免修改缓存
+	items := make([]runtime.Object, len(ret.Items))
+	for i, item := range ret.Items {
+		items[i] = item.DeepCopyObject()
+	}
+	if err := meta.SetList(obj, items); err != nil {
+		return fmt.Errorf("set items to %T error: %w", obj, err)
+	}
+	obj.SetResourceVersion(formatResourceVersion(ret.ResourceVersion))
+	obj.SetContinue(ret.Continue)
+	obj.SetRemainingItemCount(ret.RemainingItemCount)
+
+	return nil
+}
+
+// listFromCache 从缓存列出匹配的对象，结果中的对象与缓存共享，不能修改
+func (h *CacheProxyHandler) listFromCache(
+	ctx context.Context,
+	wc *watchCache,
+	namespace string,
+	opts metav1.ListOptions,
+) (*listResult, error) {
+	labelSelector, fieldSelector, err := parseSelectors(opts)
+	if err != nil {
+		return nil, err
+	}
+	if fieldSelector, err = h.convertFieldSelector(wc, fieldSelector); err != nil {
+		return nil, err
+	}
+	if err := validateListResourceVersion(opts); err != nil {
+		return nil, err
+	}
+	if opts.Continue == "" {
+		if err := waitForResourceVersion(ctx, wc, opts.ResourceVersion); err != nil {
+			return nil, err
 		}
-		listOpts.FieldSelector = selector
 	}
 
-	return h.cache.List(ctx, obj, listOpts)
+	ret, err := wc.List(namespace, opts, labelSelector, fieldSelector)
+	if err != nil {
+		if errors.Is(err, errResourceVersionNotCached) {
+			return nil, fmt.Errorf("%w: %w", errPassthrough, err)
+		}
+		return nil, err
+	}
+	return ret, nil
 }
 
-// ensureInformer 确保资源对应 informer 就绪
-func (h *CacheProxyHandler) ensureInformer(ctx context.Context, gvr schema.GroupVersionResource) error {
+// ensureInformer 确保资源对应 informer 就绪，并返回对应的 watchCache
+//
+// 优先使用跨所有命名空间的 informer 。命名空间级资源在配置了缓存的命名空间，
+// 或没有跨命名空间列出资源的权限时，使用 namespace 命名空间的 informer
+func (h *CacheProxyHandler) ensureInformer(
+	ctx context.Context,
+	gvr schema.GroupVersionResource,
+	namespace string,
+) (*watchCache, error) {
 	logger := logr.FromContextOrDiscard(ctx)
 
 	// 检查是否已经启动过对应的 informer
-	h.startedInformersLock.RLock()
-	if h.startedInformers[gvr] {
-		h.startedInformersLock.RUnlock()
-		return nil
+	h.watchCachesLock.RLock()
+	wc := h.getWatchCacheLocked(gvr, namespace)
+	h.watchCachesLock.RUnlock()
+	if wc != nil {
+		wc.Touch()
+		return wc, nil
+	}
+
+	gvk, err := h.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, fmt.Errorf("get kind for %s error: %w", gvr.String(), err)
+	}
+	namespaced, err := h.isNamespaced(gvk)
+	if err != nil {
+		return nil, err
+	}
+	// 不持有锁获取需要额外索引的字段，其中可能需要等待 CRD 同步
+	extraFields := h.extraIndexFields(ctx, gvk)
+
+	key := watchCacheKey{gvr: gvr}
+	if namespaced && h.namespaces.Len() > 0 {
+		// 仅缓存配置的命名空间
+		if !h.namespaces.Has(namespace) {
+			return nil, fmt.Errorf("%w: namespace %q is not cached", errPassthrough, namespace)
+		}
+		key.namespace = namespace
+		return h.ensureInformerForKey(ctx, key, gvk, extraFields)
+	}
+	wc, err = h.ensureInformerForKey(ctx, key, gvk, extraFields)
+	if err == nil || !namespaced || namespace == "" || !apierrors.IsForbidden(err) {
+		return wc, err
 	}
+	// 没有跨命名空间列出资源的权限，只缓存请求的命名空间
+	logger.V(1).Info(fmt.Sprintf("cache %s in namespace %q only: %v", gvr, namespace, err))
+	key.namespace = namespace
+	return h.ensureInformerForKey(ctx, key, gvk, extraFields)
+}
+
+// ensureInformerForKey 确保 key 对应的 informer 就绪，并返回对应的 watchCache
+//
+// 持有 watchCachesLock 时只检查和登记启动中的 informer ，检查权限、创建 informer 和等待同步都在后台进行且不持有锁，
+// 同一 key 的请求共享同一次启动
+func (h *CacheProxyHandler) ensureInformerForKey(
+	ctx context.Context,
+	key watchCacheKey,
+	gvk schema.GroupVersionKind,
+	extraFields []apiextensionsv1.SelectableField,
+) (*watchCache, error) {
+	// 最近无法建立 informer 的资源暂时直连
+	if err := h.fallbacks.Check(key); err != nil {
+		return nil, err
+	}
+
+	h.watchCachesLock.Lock()
+	if wc := h.watchCaches[key]; wc != nil {
+		h.watchCachesLock.Unlock()
+		wc.Touch()
+		return wc, nil
+	}
+	start, ok := h.startingInformers[key]
+	if !ok {
+		start = &informerStart{done: make(chan struct{})}
+		if h.startingInformers == nil {
+			h.startingInformers = make(map[watchCacheKey]*informerStart)
+		}
+		h.startingInformers[key] = start
+		go func() {
+			// 请求结束后其它请求可能仍在等待，不随请求取消
+			ctx := context.WithoutCancel(ctx)
+			wc, err := h.startInformer(ctx, key, gvk, extraFields)
+			h.finishInformerStart(ctx, key, start, wc, err)
+		}()
+	}
+	h.watchCachesLock.Unlock()
 
-	// 换成写锁继续
-	h.startedInformersLock.RUnlock()
-	h.startedInformersLock.Lock()
-	defer h.startedInformersLock.Unlock()
+	select {
+	case <-start.done:
+		if start.err != nil {
+			return nil, start.err
+		}
+		start.wc.Touch()
+		return start.wc, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
 
-	// 换成写锁后再检查一遍，因为换锁过程中仍然有可能被修改
-	if h.startedInformers[gvr] {
+// getWatchCacheLocked 获取已就绪的跨所有命名空间或 namespace 命名空间的 watchCache ，没有时返回 nil ，需要持有 watchCachesLock
+func (h *CacheProxyHandler) getWatchCacheLocked(gvr schema.GroupVersionResource, namespace string) *watchCache {
+	if wc, ok := h.watchCaches[watchCacheKey{gvr: gvr}]; ok {
+		return wc
+	}
+	if namespace == "" {
 		return nil
 	}
+	return h.watchCaches[watchCacheKey{gvr: gvr, namespace: namespace}]
+}
 
-	gvk, err := h.mapper.KindFor(gvr)
+// checkInformerAllowed 检查能否建立 informer
+//
+// 最近无法建立 informer 的资源暂时直连。启动 informer 前确认能够列出资源，避免 informer 不断重试。
+// 确认最多等待 informerSyncTimeout
+func (h *CacheProxyHandler) checkInformerAllowed(ctx context.Context, key watchCacheKey) error {
+	if err := h.fallbacks.Check(key); err != nil {
+		return err
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, informerSyncTimeout)
+	defer cancel()
+	if err := h.probeResource(probeCtx, key); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logr.FromContextOrDiscard(ctx).Info(fmt.Sprintf(
+			"%s falls back to passthrough for %s: %v", key, passthroughCoolDown, err,
+		))
+		return h.fallbacks.Add(key, passthroughCoolDown, err)
+	}
+	return nil
+}
+
+// informerStart 启动中的 informer
+type informerStart struct {
+	// 启动结束后关闭，之后 wc 和 err 不再变化
+	done chan struct{}
+	wc   *watchCache
+	err  error
+}
+
+// startInformer 检查权限后启动资源的 informer ，等待其同步后创建对应的 watchCache ，不能持有 watchCachesLock
+//
+// 获取 informer 时不等待其同步，字段索引直接添加到 informer 上。超过 informerSyncTimeout 未同步时停止 informer 并暂时直连
+func (h *CacheProxyHandler) startInformer(
+	ctx context.Context,
+	key watchCacheKey,
+	gvk schema.GroupVersionKind,
+	extraFields []apiextensionsv1.SelectableField,
+) (*watchCache, error) {
+	if err := h.checkInformerAllowed(ctx, key); err != nil {
+		return nil, err
+	}
+
+	h.watchCachesLock.Lock()
+	c, err := h.cacheForNamespaceLocked(key.namespace)
+	h.watchCachesLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	metadataOnly := h.metadataOnly.Has(key.gvr.GroupResource())
+	clientObj, err := h.newInformerObject(gvk, metadataOnly)
+	if err != nil {
+		return nil, err
+	}
+	// 记录对象的字段索引
+	recorder := newFieldIndexRecorder()
+	if metadataOnly {
+		// 仅支持 metadata 字段索引
+		if err := IndexFieldsForObjectMeta(ctx, recorder, clientObj); err != nil {
+			return nil, fmt.Errorf("index fields for %s error: %w", gvk, err)
+		}
+	} else if err := IndexFieldsForObject(ctx, recorder, h.scheme, gvk, clientObj, extraFields); err != nil {
+		return nil, fmt.Errorf("index fields for %s error: %w", gvk, err)
+	}
+	// 创建 informer ，不等待同步
+	writeSeq := h.writes.Seq()
+	informer, err := c.GetInformer(ctx, clientObj, cache.BlockUntilSynced(false))
+	if err != nil {
+		return nil, err
+	}
+	if err := informer.AddIndexers(recorder.Indexers()); err != nil {
+		if err := c.RemoveInformer(ctx, clientObj); err != nil {
+			logr.FromContextOrDiscard(ctx).Error(err, fmt.Sprintf("remove informer for %s error", key))
+		}
+		return nil, fmt.Errorf("add field indexers to informer for %s error: %w", key, err)
+	}
+	wc, err := h.syncInformer(ctx, key, gvk, metadataOnly, c, clientObj, informer, recorder.Indexers())
 	if err != nil {
-		return fmt.Errorf("get kind for %s error: %w", gvr.String(), err)
+		return nil, err
+	}
+	wc.writeSeq = writeSeq
+	return wc, nil
+}
+
+// syncInformer 等待 informer 同步，创建 watchCache 并等待其载入 informer 中已有的对象
+func (h *CacheProxyHandler) syncInformer(
+	ctx context.Context,
+	key watchCacheKey,
+	gvk schema.GroupVersionKind,
+	metadataOnly bool,
+	c cache.Cache,
+	clientObj client.Object,
+	informer cache.Informer,
+	indexers toolscache.Indexers,
+) (*watchCache, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	logger.V(1).Info(fmt.Sprintf("waiting for informer for %s", key))
+	syncCtx, cancel := context.WithTimeout(ctx, informerSyncTimeout)
+	defer cancel()
+	if !toolscache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced) {
+		// 超时，停止不断重试的 informer 并暂时直连
+		if err := c.RemoveInformer(ctx, clientObj); err != nil {
+			logger.Error(err, fmt.Sprintf("remove informer for %s error", key))
+		}
+		err := fmt.Errorf("informer for %s not synced in %s", key, informerSyncTimeout)
+		logger.Info(fmt.Sprintf("%s falls back to passthrough for %s: %v", key, passthroughCoolDown, err))
+		return nil, h.fallbacks.Add(key, passthroughCoolDown, err)
 	}
+
+	// 创建 watchCache 并等待其载入 informer 中已有的对象
+	wc := newWatchCache(gvk, informer, defaultWatchCacheCapacity)
+	wc.metadataOnly = metadataOnly
+	if _, ok := informer.(toolscache.SharedIndexInformer); !ok {
+		// 命名空间的 informer 由多个 informer 组合而成，不能获取其上的字段索引，使用记录的索引
+		if err := wc.store.AddIndexers(indexers); err != nil {
+			return nil, fmt.Errorf("add field indexers for %s error: %w", key, err)
+		}
+	}
+	registration, err := informer.AddEventHandler(wc.EventHandler())
+	if err != nil {
+		return nil, fmt.Errorf("add event handler to informer for %s error: %w", key, err)
+	}
+	if !toolscache.WaitForCacheSync(syncCtx.Done(), registration.HasSynced) {
+		_ = informer.RemoveEventHandler(registration)
+		return nil, fmt.Errorf("wait for watch cache for %s synced error: %w", key, syncCtx.Err())
+	}
+	return wc, nil
+}
+
+// finishInformerStart 记录 informer 启动的结果，成功时添加 watchCache ，并唤醒等待的请求
+func (h *CacheProxyHandler) finishInformerStart(
+	ctx context.Context,
+	key watchCacheKey,
+	start *informerStart,
+	wc *watchCache,
+	err error,
+) {
+	h.watchCachesLock.Lock()
+	defer h.watchCachesLock.Unlock()
+	defer close(start.done)
+
+	delete(h.startingInformers, key)
+	if err != nil {
+		start.err = err
+		return
+	}
+	if h.watchCaches == nil {
+		h.watchCaches = make(map[watchCacheKey]*watchCache)
+	}
+	h.watchCaches[key] = wc
+	if h.maxMemory > 0 {
+		// 新的缓存可能使内存占用超过限制
+		h.enforceMemoryLimitLocked(ctx, h.maxMemory)
+		if _, ok := h.watchCaches[key]; !ok {
+			// 被移除时已记录为暂时直连
+			start.err = h.fallbacks.Check(key)
+			return
+		}
+	}
+	start.wc = wc
+}
+
+// newInformerObject 创建用于获取指定类型 informer 的对象
+func (h *CacheProxyHandler) newInformerObject(gvk schema.GroupVersionKind, metadataOnly bool) (client.Object, error) {
 	obj, err := h.scheme.New(gvk)
 	if err != nil {
 		obj = &unstructured.Unstructured{}
 		obj.GetObjectKind().SetGroupVersionKind(gvk)
 	}
+	if metadataOnly {
+		// 使用 PartialObjectMetadata 对象创建的 informer 仅缓存元数据
+		obj = &metav1.PartialObjectMetadata{}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+	}
 
-	if clientObj, ok := obj.(client.Object); ok {
-		// 为对象设置字段索引
-		if err := IndexFieldsForObject(ctx, h.cache, clientObj); err != nil {
-			return fmt.Errorf("index fields for %T error: %w", obj, err)
+	clientObj, ok := obj.(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a client.Object", obj)
+	}
+	return clientObj, nil
+}
+
+// handleAPIChange 处理 APIServer 提供的 API 的变化
+//
+// 清空 discovery 缓存，并在 CRD 被删除时停止其定义的资源的 informer
+func (h *CacheProxyHandler) handleAPIChange(ctx context.Context, event APIChangeEvent) {
+	if cached, ok := h.discovery.(discovery.CachedDiscoveryInterface); ok {
+		cached.Invalidate()
+	}
+	if event.Deleted && event.Resource == crdGVR.GroupResource() {
+		// CRD 名为 <资源复数名>.<组>
+		if resource, group, ok := strings.Cut(event.Name, "."); ok {
+			h.removeInformers(ctx, schema.GroupResource{Group: group, Resource: resource})
 		}
-		// 创建 informer 并等待缓存同步
-		logger.V(1).Info(fmt.Sprintf("waiting for informer for %s", gvk))
-		if _, err := h.cache.GetInformer(ctx, clientObj, cache.BlockUntilSynced(true)); err != nil {
-			return err
+	}
+}
+
+// removeInformers 停止并移除指定资源所有版本的 informer 和 watchCache
+func (h *CacheProxyHandler) removeInformers(ctx context.Context, gr schema.GroupResource) {
+	h.watchCachesLock.Lock()
+	defer h.watchCachesLock.Unlock()
+
+	for key, wc := range h.watchCaches {
+		if key.gvr.GroupResource() == gr {
+			h.removeInformerLocked(ctx, key, wc)
 		}
 	}
+}
+
+// removeInformerLocked 停止并移除 informer （包括其上的索引）和对应的 watchCache ，需要持有 watchCachesLock 的写锁
+func (h *CacheProxyHandler) removeInformerLocked(ctx context.Context, key watchCacheKey, wc *watchCache) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	delete(h.watchCaches, key)
+	// 结束正在进行的 watch
+	wc.Stop()
+
+	c, err := h.cacheForNamespaceLocked(key.namespace)
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("remove informer for %s error", key))
+		return
+	}
+	obj, err := h.newInformerObject(wc.gvk, wc.metadataOnly)
+	if err == nil {
+		err = c.RemoveInformer(ctx, obj)
+	}
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("remove informer for %s error", key))
+		return
+	}
+	logger.V(1).Info(fmt.Sprintf("removed informer for %s", key))
+}
 
-	if h.startedInformers == nil {
-		h.startedInformers = make(map[schema.GroupVersionResource]bool)
+// extraIndexFields 返回除 metadata 和内置资源支持的字段外，需要额外索引的 CRD 中声明的和用户自定义的字段
+//
+// 等待 CRD 同步超时时不包含 CRD 中声明的字段，通过这些字段选择的请求直连
+func (h *CacheProxyHandler) extraIndexFields(ctx context.Context, gvk schema.GroupVersionKind) []apiextensionsv1.SelectableField {
+	var extraFields []apiextensionsv1.SelectableField
+	if !h.scheme.Recognizes(gvk) {
+		// 定制资源，添加 CRD 中声明的可选字段索引
+		if err := h.waitForCRDSynced(ctx); err != nil {
+			logr.FromContextOrDiscard(ctx).Info(fmt.Sprintf("index %s without selectable fields in crd: %v", gvk, err))
+		} else if version, err := FindCRDVersion(h.crdLister, gvk); err == nil {
+			extraFields = append(extraFields, version.SelectableFields...)
+		}
 	}
-	h.startedInformers[gvr] = true
+	// 用户自定义的字段索引
+	return append(extraFields, h.fieldIndexes[gvk]...)
+}
 
+// waitForCRDSynced 等待 CRD lister 同步，超过 informerSyncTimeout 未同步时返回 errPassthrough
+func (h *CacheProxyHandler) waitForCRDSynced(ctx context.Context) error {
+	waitCtx, cancel := context.WithTimeout(ctx, informerSyncTimeout)
+	defer cancel()
+	if !toolscache.WaitForCacheSync(waitCtx.Done(), h.crdSynced) {
+		if ctx.Err() != nil {
+			return fmt.Errorf("wait for crd lister synced error: %w", ctx.Err())
+		}
+		return fmt.Errorf("%w: crd lister not synced in %s", errPassthrough, informerSyncTimeout)
+	}
 	return nil
 }
 
+// validateListResourceVersion 检查列表选项中资源版本相关参数的组合是否合法
+func validateListResourceVersion(opts metav1.ListOptions) error {
+	switch opts.ResourceVersionMatch {
+	case "":
+	case metav1.ResourceVersionMatchNotOlderThan, metav1.ResourceVersionMatchExact:
+		if opts.ResourceVersion == "" {
+			return apierrors.NewBadRequest("resourceVersionMatch is forbidden unless resourceVersion is provided")
+		}
+		if opts.Continue != "" {
+			return apierrors.NewBadRequest("resourceVersionMatch is forbidden when continue is provided")
+		}
+		if opts.ResourceVersionMatch == metav1.ResourceVersionMatchExact && opts.ResourceVersion == "0" {
+			return apierrors.NewBadRequest(`resourceVersionMatch "Exact" is forbidden for resourceVersion "0"`)
+		}
+	default:
+		return apierrors.NewBadRequest(fmt.Sprintf("unsupported resourceVersionMatch: %q", opts.ResourceVersionMatch))
+	}
+	if opts.Continue != "" && opts.ResourceVersion != "" && opts.ResourceVersion != "0" {
+		return apierrors.NewBadRequest("specifying resource version is not allowed when using continue")
+	}
+	return nil
+}
+
+// waitForResourceVersion 等待缓存不旧于请求的资源版本
+//
+// resourceVersion 为空或 "0" 时不等待，等待超时返回 errPassthrough
+func waitForResourceVersion(ctx context.Context, wc *watchCache, resourceVersion string) error {
+	rv, err := parseResourceVersion(resourceVersion)
+	if err != nil {
+		return apierrors.NewBadRequest(err.Error())
+	}
+	if rv == 0 {
+		return nil
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, resourceVersionTooLargeWaitTime)
+	defer cancel()
+	if err := wc.WaitUntilFresh(waitCtx, rv); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %w", errPassthrough, storage.NewTooLargeResourceVersionError(rv, wc.ResourceVersion(), 0))
+	}
+	return nil
+}
+
+// parseSelectors 解析列表选项中的标签选择器和字段选择器
+func parseSelectors(opts metav1.ListOptions) (labels.Selector, fields.Selector, error) {
+	labelSelector := labels.Everything()
+	fieldSelector := fields.Everything()
+	if opts.LabelSelector != "" {
+		selector, err := labels.Parse(opts.LabelSelector)
+		if err != nil {
+			return nil, nil, apierrors.NewBadRequest(err.Error())
+		}
+		labelSelector = selector
+	}
+	if opts.FieldSelector != "" {
+		selector, err := fields.ParseSelector(opts.FieldSelector)
+		if err != nil {
+			return nil, nil, apierrors.NewBadRequest(err.Error())
+		}
+		fieldSelector = selector
+	}
+	return labelSelector, fieldSelector, nil
+}
+
+// convertFieldSelector 将字段选择器中请求版本的字段标签转换为缓存索引使用的字段标签
+//
+// 与 APIServer 一致，内置资源使用 scheme 中注册的字段标签转换方法，不支持的字段返回错误。已有索引的字段不转换
+func (h *CacheProxyHandler) convertFieldSelector(wc *watchCache, selector fields.Selector) (fields.Selector, error) {
+	if selector.Empty() {
+		return selector, nil
+	}
+	indexers := wc.store.GetIndexers()
+	ret := selector
+	if h.scheme.Recognizes(wc.gvk) {
+		var err error
+		ret, err = selector.Transform(func(label, value string) (string, string, error) {
+			if _, ok := indexers[fieldIndexName(label)]; ok {
+				return label, value, nil
+			}
+			return h.scheme.ConvertFieldLabel(wc.gvk, label, value)
+		})
+		if err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+	}
+	if wc.metadataOnly {
+		// 仅缓存了元数据时，其它字段交给 APIServer 处理
+		for _, req := range ret.Requirements() {
+			if _, ok := indexers[fieldIndexName(req.Field)]; !ok {
+				return nil, fmt.Errorf("%w: field %q of %s is not cached", errPassthrough, req.Field, wc.gvk)
+			}
+		}
+	}
+	return ret, nil
+}
+
 // ConvertToTable 将 obj 转换为表格形式
+//
+// 与 APIServer 一致，每行的 Object 按 opts.IncludeObject 处理：为空或 Metadata 时转为 PartialObjectMetadata ，
+// None 时去掉， Object 时保留完整对象
 func ConvertToTable(
 	ctx context.Context,
 	tableConvertor registryrest.TableConvertor,
 	obj runtime.Object,
+	opts *metav1.TableOptions,
 ) (*metav1.Table, error) {
-	// 转换为表格
-	table, err := tableConvertor.ConvertToTable(ctx, obj, nil)
+	// 转换为表格，避免传入值为 nil 的非空接口
+	var tableOpts runtime.Object
+	if opts != nil {
+		tableOpts = opts
+	}
+	table, err := tableConvertor.ConvertToTable(ctx, obj, tableOpts)
 	if err != nil {
 		return nil, err
 	}
 	table.GetObjectKind().SetGroupVersionKind(metav1.SchemeGroupVersion.WithKind("Table"))
 
-	// 将每行 Object 转为 PartialObjectMetadata 或 PartialObjectMetadataList
+	includeObject := metav1.IncludeMetadata
+	if opts != nil && opts.IncludeObject != "" {
+		includeObject = opts.IncludeObject
+	}
 	for i, row := range table.Rows {
-		if row.Object.Object == nil || row.Object.Raw != nil {
-			continue
-		}
-		partial, ok := ToPartial(row.Object.Object)
-		if !ok {
-			continue
+		switch includeObject {
+		case metav1.IncludeNone:
+			table.Rows[i].Object = runtime.RawExtension{}
+		case metav1.IncludeObject:
+		default:
+			// 将每行 Object 转为 PartialObjectMetadata 或 PartialObjectMetadataList
+			if row.Object.Object == nil || row.Object.Raw != nil {
+				continue
+			}
+			partial, ok := ToPartial(row.Object.Object)
+			if !ok {
+				continue
+			}
+			table.Rows[i].Object.Object = partial
 		}
-		table.Rows[i].Object.Object = partial
 	}
 
 	return table, nil
 }
 
-// WriteResponse 写响应
-func WriteResponse(w http.ResponseWriter, code int, obj interface{}) {
-	if status, ok := obj.(metav1.Status); ok {
-		status.APIVersion = "v1"
-		status.Kind = "Status"
-		obj = status
-	}
-
-	raw, err := json.Marshal(obj)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	_, _ = w.Write(raw)
-}
-
 // ParseGetOptions 解析请求 Get 选项
 func ParseGetOptions(req *http.Request) (metav1.GetOptions, error) {
 	ret := metav1.GetOptions{}
@@ -399,6 +1227,25 @@ func ParseListOptions(req *http.Request) (metav1.ListOptions, error) {
 	return ret, nil
 }
 
+// ParseTableOptions 解析请求表格选项
+//
+// 与 APIServer 一致， includeObject 只能为空或 None 、 Metadata 、 Object 之一
+func ParseTableOptions(req *http.Request) (*metav1.TableOptions, error) {
+	ret := &metav1.TableOptions{}
+	values := req.URL.Query()
+	if len(values) > 0 {
+		if err := metascheme.ParameterCodec.DecodeParameters(values, metav1.SchemeGroupVersion, ret); err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("failed to parse table options: %v", err))
+		}
+	}
+	switch ret.IncludeObject {
+	case "", metav1.IncludeNone, metav1.IncludeMetadata, metav1.IncludeObject:
+	default:
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("unrecognized includeObject value: %q", ret.IncludeObject))
+	}
+	return ret, nil
+}
+
 // ToPartial 从对象提取仅包含 metadata 的部分
 func ToPartial(obj runtime.Object) (runtime.Object, bool) {
 	switch typedObj := obj.(type) {
@@ -444,29 +1291,3 @@ func ToPartial(obj runtime.Object) (runtime.Object, bool) {
 	}
 	return nil, false
 }
-
-// sortObjectsByNamespaceName 将列表对象元素按命名空间和名升序排序
-func sortObjectsByNamespaceName(listObj runtime.Object) error {
-	if !meta.IsListType(listObj) {
-		return fmt.Errorf("%T is not a list type", listObj)
-	}
-	objs, err := meta.ExtractList(listObj)
-	if err != nil {
-		return fmt.Errorf("extract list from %T error: %w", listObj, err)
-	}
-	if len(objs) == 0 {
-		return nil
-	}
-	if _, ok := objs[0].(metav1.Object); !ok {
-		return fmt.Errorf("%T is not has metadata field", listObj)
-	}
-	sort.Slice(objs, func(i, j int) bool {
-		objMetaI := objs[i].(metav1.Object)
-		objMetaJ := objs[j].(metav1.Object)
-		if objNSI, objNSJ := objMetaI.GetNamespace(), objMetaJ.GetNamespace(); objNSI != objNSJ {
-			return objNSI < objNSJ
-		}
-		return objMetaI.GetName() < objMetaJ.GetName()
-	})
-	return meta.SetList(listObj, objs)
-}
@@ -0,0 +1,382 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/metadata"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+// TestConvertToTable 测试按表格选项转换表格
+func TestConvertToTable(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	tableConvertor := NewDefaultTableConvertor(scheme, nil)
+
+	newList := func() runtime.Object {
+		list := &corev1.PodList{Items: []corev1.Pod{*newTestPod("default", "a", "10")}}
+		list.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PodList"))
+		return list
+	}
+
+	for query, check := range map[string]func(t *testing.T, table *metav1.Table){
+		"": func(t *testing.T, table *metav1.Table) {
+			if _, ok := table.Rows[0].Object.Object.(*metav1.PartialObjectMetadata); !ok {
+				t.Errorf("expected *metav1.PartialObjectMetadata, got: %T", table.Rows[0].Object.Object)
+			}
+		},
+		"includeObject=None": func(t *testing.T, table *metav1.Table) {
+			if table.Rows[0].Object.Object != nil || len(table.ColumnDefinitions) == 0 {
+				t.Errorf("unexpected table: %#v", table)
+			}
+		},
+		"includeObject=Object": func(t *testing.T, table *metav1.Table) {
+			pod, ok := table.Rows[0].Object.Object.(*corev1.Pod)
+			if !ok {
+				t.Fatalf("expected *corev1.Pod, got: %T", table.Rows[0].Object.Object)
+			}
+			if pod.Name != "a" || pod.Kind != "Pod" || len(table.ColumnDefinitions) == 0 {
+				t.Errorf("unexpected pod: %#v", pod)
+			}
+		},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/pods?"+query, nil)
+		opts, err := ParseTableOptions(req)
+		if err != nil {
+			t.Fatalf("%q: parse table options error: %v", query, err)
+		}
+		table, err := ConvertToTable(context.Background(), tableConvertor, newList(), opts)
+		if err != nil {
+			t.Fatalf("%q: convert to table error: %v", query, err)
+		}
+		if len(table.Rows) != 1 {
+			t.Fatalf("%q: expected 1 row, got: %d", query, len(table.Rows))
+		}
+		check(t, table)
+	}
+
+	// 仅内部使用的 noHeaders
+	table, err := ConvertToTable(context.Background(), tableConvertor, newList(), &metav1.TableOptions{NoHeaders: true})
+	if err != nil {
+		t.Fatalf("convert to table error: %v", err)
+	}
+	if len(table.ColumnDefinitions) != 0 || len(table.Rows) != 1 {
+		t.Errorf("unexpected table without headers: %#v", table)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/pods?includeObject=Unknown", nil)
+	if _, err := ParseTableOptions(req); err == nil {
+		t.Errorf("expected error for unknown includeObject, got nil")
+	}
+}
+
+// TestWaitForConsistentRead 测试一致性读等待缓存追上 APIServer 当前的资源版本
+func TestWaitForConsistentRead(t *testing.T) {
+	// APIServer 当前的资源版本
+	var apiServerRV string
+	client := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	client.PrependReactor("list", "pods", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &metav1.List{ListMeta: metav1.ListMeta{ResourceVersion: apiServerRV}}, nil
+	})
+	h := &CacheProxyHandler{metadataClient: client}
+	pods := corev1.SchemeGroupVersion.WithResource("pods")
+
+	wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), nil, 10)
+	handler := wc.EventHandler()
+	handler.OnAdd(newTestPod("default", "a", "10"), true)
+	handler.OnAdd(newTestPod("default", "b", "11"), true)
+
+	// 缓存已追上，不需要等待
+	apiServerRV = "11"
+	start := time.Now()
+	if err := h.waitForConsistentRead(context.Background(), wc, pods, "default"); err != nil {
+		t.Fatalf("wait for consistent read error: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected no wait, waited: %s", d)
+	}
+
+	// 有写入的资源，等待缓存收到写入
+	apiServerRV = "13"
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		handler.OnUpdate(newTestPod("default", "a", "10"), newTestPod("default", "a", "12"))
+		handler.OnAdd(newTestPod("default", "c", "13"), false)
+	}()
+	if err := h.waitForConsistentRead(context.Background(), wc, pods, "default"); err != nil {
+		t.Fatalf("wait for consistent read error: %v", err)
+	}
+	if _, exists, _ := wc.Get("default", "c"); !exists {
+		t.Errorf("expected pod c in cache")
+	}
+
+	// 缓存没有追上（比如资源最近没有写入），直连
+	apiServerRV = "100"
+	if err := h.waitForConsistentRead(context.Background(), wc, pods, "default"); !errors.Is(err, errPassthrough) {
+		t.Errorf("expected passthrough error, got: %v", err)
+	}
+}
+
+// TestWaitForLatestAfterWriteInOtherNamespace 测试在一个命名空间写入后，读取其它命名空间的缓存不需要等待
+func TestWaitForLatestAfterWriteInOtherNamespace(t *testing.T) {
+	h := &CacheProxyHandler{
+		resolver: &apirequest.RequestInfoFactory{
+			APIPrefixes:          sets.NewString("apis", "api"),
+			GrouplessAPIPrefixes: sets.NewString("api"),
+		},
+		passthrough: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"metadata":{"namespace":"a","name":"x","resourceVersion":"50"}}`))
+		}),
+	}
+	pods := corev1.SchemeGroupVersion.WithResource("pods")
+	newNamespaceWatchCache := func(namespace string) (*watchCache, toolscache.ResourceEventHandler) {
+		wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), nil, 10)
+		wc.writeSeq = h.writes.Seq()
+		handler := wc.EventHandler()
+		handler.OnAdd(newTestPod(namespace, "old", "10"), true)
+		return wc, handler
+	}
+	wcA, handlerA := newNamespaceWatchCache("a")
+	wcB, _ := newNamespaceWatchCache("b")
+
+	// 在命名空间 a 中写入
+	h.ServeWrite(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/namespaces/a/pods", nil))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+
+	// 命名空间 b 的缓存不包含该写入，不需要等待
+	start := time.Now()
+	if err := h.waitForLatest(context.Background(), req, wcB, pods, "b"); err != nil {
+		t.Fatalf("wait for latest in namespace b error: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected no wait in namespace b, waited: %s", d)
+	}
+
+	// 命名空间 a 的缓存等待收到该写入
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		handlerA.OnAdd(newTestPod("a", "x", "50"), false)
+	}()
+	if err := h.waitForLatest(context.Background(), req, wcA, pods, "a"); err != nil {
+		t.Fatalf("wait for latest in namespace a error: %v", err)
+	}
+	if _, exists, _ := wcA.Get("a", "x"); !exists {
+		t.Errorf("expected pod x in cache of namespace a")
+	}
+
+	// 写入后重新创建的缓存首次列出的对象已包含该写入，不需要等待
+	wcA, _ = newNamespaceWatchCache("a")
+	start = time.Now()
+	if err := h.waitForLatest(context.Background(), req, wcA, pods, "a"); err != nil {
+		t.Fatalf("wait for latest in recreated cache of namespace a error: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected no wait in recreated cache of namespace a, waited: %s", d)
+	}
+}
+
+// TestEnsureInformerSyncTimeout 测试 informer 一直不同步时请求在超时后直连，且等待期间不阻塞其它请求
+func TestEnsureInformerSyncTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { informerSyncTimeout = timeout }(informerSyncTimeout)
+	informerSyncTimeout = 500 * time.Millisecond
+
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+	client := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	client.PrependReactor("list", "pods", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &metav1.List{}, nil
+	})
+	// informertest.FakeInformers 创建的 informer 默认一直不同步
+	fakeCache := &informertest.FakeInformers{Scheme: scheme}
+	h := &CacheProxyHandler{scheme: scheme, cache: fakeCache, mapper: mapper, metadataClient: client}
+	pods := corev1.SchemeGroupVersion.WithResource("pods")
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := h.ensureInformer(context.Background(), pods, "default")
+		errCh <- err
+	}()
+
+	// 等待同步期间不持有锁
+	time.Sleep(100 * time.Millisecond)
+	statusStart := time.Now()
+	_ = h.Status()
+	if d := time.Since(statusStart); d > 100*time.Millisecond {
+		t.Errorf("expected status not blocked by informer sync, blocked: %s", d)
+	}
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, errPassthrough) {
+			t.Errorf("expected passthrough error, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected ensure informer returned after sync timeout")
+	}
+	if d := time.Since(start); d < informerSyncTimeout {
+		t.Errorf("expected waiting for informer sync timeout %s, waited: %s", informerSyncTimeout, d)
+	}
+	if err := h.fallbacks.Check(watchCacheKey{gvr: pods}); !errors.Is(err, errPassthrough) {
+		t.Errorf("expected pods passthrough, got: %v", err)
+	}
+	h.watchCachesLock.RLock()
+	defer h.watchCachesLock.RUnlock()
+	if _, ok := fakeCache.InformersByGVK[corev1.SchemeGroupVersion.WithKind("Pod")]; ok {
+		t.Errorf("expected informer for pods removed")
+	}
+	if len(h.watchCaches) != 0 || len(h.startingInformers) != 0 {
+		t.Errorf("expected no watch cache, got: %v, %v", h.watchCaches, h.startingInformers)
+	}
+}
+
+// TestExtraIndexFieldsCRDNotSynced 测试 CRD 一直不同步时等待超时后只索引用户自定义的字段
+func TestExtraIndexFieldsCRDNotSynced(t *testing.T) {
+	defer func(timeout time.Duration) { informerSyncTimeout = timeout }(informerSyncTimeout)
+	informerSyncTimeout = 200 * time.Millisecond
+
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	fooGVK := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Foo"}
+	userFields := []apiextensionsv1.SelectableField{{JSONPath: ".status.cluster"}}
+	h := &CacheProxyHandler{
+		scheme:       scheme,
+		crdSynced:    func() bool { return false },
+		fieldIndexes: map[schema.GroupVersionKind][]apiextensionsv1.SelectableField{fooGVK: userFields},
+	}
+
+	start := time.Now()
+	fields := h.extraIndexFields(context.Background(), fooGVK)
+	if d := time.Since(start); d > 5*informerSyncTimeout {
+		t.Errorf("expected waiting for crd synced at most about %s, waited: %s", informerSyncTimeout, d)
+	}
+	if !reflect.DeepEqual(fields, userFields) {
+		t.Errorf("expected: %v, got: %v", userFields, fields)
+	}
+	if err := h.waitForCRDSynced(context.Background()); !errors.Is(err, errPassthrough) {
+		t.Errorf("expected passthrough error, got: %v", err)
+	}
+}
+
+// TestEnsureInformerProbeHangs 测试检查权限一直没有响应时不阻塞其它资源的请求，同一资源的请求共享同一次检查
+func TestEnsureInformerProbeHangs(t *testing.T) {
+	defer func(timeout time.Duration) { informerSyncTimeout = timeout }(informerSyncTimeout)
+	informerSyncTimeout = 300 * time.Millisecond
+
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	fakeClient := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	fakeClient.PrependReactor("list", "*", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, &metav1.List{}, nil
+	})
+	unblock := make(chan struct{})
+	client := &hangingMetadataClient{
+		Interface: fakeClient,
+		resource:  corev1.SchemeGroupVersion.WithResource("pods"),
+		unblock:   unblock,
+	}
+	h := &CacheProxyHandler{
+		scheme:         scheme,
+		cache:          &informertest.FakeInformers{Scheme: scheme},
+		mapper:         mapper,
+		metadataClient: client,
+	}
+	pods := corev1.SchemeGroupVersion.WithResource("pods")
+
+	// 两个请求等待同一次检查，请求结束时返回
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, err := h.ensureInformer(ctx, pods, "default")
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded error, got: %v", err)
+		}
+	}
+	if n := client.lists.Load(); n != 1 {
+		t.Errorf("expected 1 probe for pods, got: %d", n)
+	}
+
+	// 其它资源的请求和状态查询不被阻塞（ configmaps 的 informer 一直不同步，超时后直连）
+	start := time.Now()
+	_ = h.Status()
+	_, err := h.ensureInformer(context.Background(), corev1.SchemeGroupVersion.WithResource("configmaps"), "default")
+	if !errors.Is(err, errPassthrough) {
+		t.Errorf("expected passthrough error, got: %v", err)
+	}
+	if d := time.Since(start); d > 3*informerSyncTimeout {
+		t.Errorf("expected not blocked by probe of pods, blocked: %s", d)
+	}
+
+	// 检查超时后 pods 暂时直连
+	close(unblock)
+	if _, err := h.ensureInformer(context.Background(), pods, "default"); !errors.Is(err, errPassthrough) {
+		t.Errorf("expected passthrough error, got: %v", err)
+	}
+}
+
+// hangingMetadataClient 列出指定资源时一直阻塞到 unblock 关闭的 metadata.Interface
+type hangingMetadataClient struct {
+	metadata.Interface
+	resource schema.GroupVersionResource
+	unblock  chan struct{}
+	// 列出指定资源的次数
+	lists atomic.Int32
+}
+
+// Resource 返回资源的客户端
+func (c *hangingMetadataClient) Resource(resource schema.GroupVersionResource) metadata.Getter {
+	getter := c.Interface.Resource(resource)
+	if resource != c.resource {
+		return getter
+	}
+	return &hangingMetadataGetter{Getter: getter, client: c}
+}
+
+// hangingMetadataGetter 列出时一直阻塞的 metadata.Getter
+type hangingMetadataGetter struct {
+	metadata.Getter
+	client *hangingMetadataClient
+}
+
+// Namespace 返回命名空间中资源的客户端
+func (g *hangingMetadataGetter) Namespace(namespace string) metadata.ResourceInterface {
+	return &hangingMetadataResource{ResourceInterface: g.Getter.Namespace(namespace), client: g.client}
+}
+
+// hangingMetadataResource 列出时一直阻塞的 metadata.ResourceInterface
+type hangingMetadataResource struct {
+	metadata.ResourceInterface
+	client *hangingMetadataClient
+}
+
+// List 阻塞到 unblock 关闭后列出资源
+func (r *hangingMetadataResource) List(ctx context.Context, opts metav1.ListOptions) (*metav1.PartialObjectMetadataList, error) {
+	r.client.lists.Add(1)
+	<-r.client.unblock
+	return r.ResourceInterface.List(ctx, opts)
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// CacheStatusPath 查询缓存状态的路径（在 API 代理路径前缀下）
+const CacheStatusPath = "/kubectl-cache/status"
+
+// CacheStatus 缓存状态
+type CacheStatus struct {
+	// 缓存估算的最大内存占用（字节），为 0 时不限制
+	MaxMemoryBytes int64 `json:"maxMemoryBytes,omitempty"`
+	// 所有 informer 估算的内存占用之和（字节）
+	MemoryBytes int64 `json:"memoryBytes"`
+	// 内存占用是否超过限制。有 watch 进行中的 informer 不会被停止，因此可能无法满足限制
+	MemoryLimitExceeded bool `json:"memoryLimitExceeded,omitempty"`
+	// 超过内存限制时的说明
+	Message string `json:"message,omitempty"`
+	// 各 informer 的状态，按估算的内存占用降序排列
+	Informers []InformerStatus `json:"informers"`
+}
+
+// InformerStatus informer 状态
+type InformerStatus struct {
+	Group    string `json:"group,omitempty"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+	Kind     string `json:"kind"`
+	// informer 所在的命名空间，为空表示所有命名空间
+	Namespace string `json:"namespace,omitempty"`
+	// 是否仅缓存元数据
+	MetadataOnly bool `json:"metadataOnly,omitempty"`
+	// 缓存的对象数
+	Objects int `json:"objects"`
+	// 估算的内存占用（字节）
+	MemoryBytes int64 `json:"memoryBytes"`
+	// 最近一次被使用的时间
+	LastAccessTime time.Time `json:"lastAccessTime"`
+	// 进行中的 watch 数
+	Watchers int `json:"watchers"`
+}
+
+// Status 返回缓存状态
+func (h *CacheProxyHandler) Status() CacheStatus {
+	h.watchCachesLock.RLock()
+	defer h.watchCachesLock.RUnlock()
+
+	status := CacheStatus{
+		MaxMemoryBytes: h.maxMemory,
+		Informers:      make([]InformerStatus, 0, len(h.watchCaches)),
+	}
+	for key, wc := range h.watchCaches {
+		wc.lock.RLock()
+		informer := InformerStatus{
+			Group:          key.gvr.Group,
+			Version:        key.gvr.Version,
+			Resource:       key.gvr.Resource,
+			Kind:           wc.gvk.Kind,
+			Namespace:      key.namespace,
+			MetadataOnly:   wc.metadataOnly,
+			Objects:        len(wc.store.ListKeys()),
+			MemoryBytes:    wc.memory,
+			LastAccessTime: time.Unix(0, wc.lastAccess.Load()),
+			Watchers:       len(wc.watchers),
+		}
+		wc.lock.RUnlock()
+		status.MemoryBytes += informer.MemoryBytes
+		status.Informers = append(status.Informers, informer)
+	}
+	if h.maxMemory > 0 && status.MemoryBytes > h.maxMemory {
+		status.MemoryLimitExceeded = true
+		status.Message = fmt.Sprintf(
+			"cache memory %s exceeds limit %s",
+			resource.NewQuantity(status.MemoryBytes, resource.BinarySI),
+			resource.NewQuantity(h.maxMemory, resource.BinarySI),
+		)
+		watching := 0
+		for _, informer := range status.Informers {
+			if informer.Watchers > 0 {
+				watching++
+			}
+		}
+		if watching > 0 {
+			status.Message += fmt.Sprintf(", %d informers with active watches can not be evicted", watching)
+		}
+	}
+	sort.Slice(status.Informers, func(i, j int) bool {
+		return status.Informers[i].MemoryBytes > status.Informers[j].MemoryBytes
+	})
+	return status
+}
+
+// ServeStatus 以 JSON 格式返回缓存状态
+func (h *CacheProxyHandler) ServeStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(h.Status())
+}
@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// gzipThresholdBytes 响应超过该大小时才压缩，与 APIServer 一致
+	gzipThresholdBytes = 128 * 1024
+	// gzipLevel gzip 压缩级别，与 APIServer 一致，优先压缩速度
+	gzipLevel = 1
+)
+
+// acceptsGzip 判断请求的 Accept-Encoding 是否接受 gzip 编码
+func acceptsGzip(req *http.Request) bool {
+	for _, header := range req.Header.Values("Accept-Encoding") {
+		for _, clause := range strings.Split(header, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(clause), ";")
+			if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+				continue
+			}
+			// 忽略 q=0 的编码
+			name, value, _ := strings.Cut(strings.TrimSpace(params), "=")
+			if strings.TrimSpace(name) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// compressionWriter 根据响应大小决定是否以 gzip 压缩的 http.ResponseWriter
+//
+// 写入的内容先缓存，超过阈值后以 gzip 编码写出，否则在 Close 时原样写出。
+// 写完后必须调用 Close
+type compressionWriter struct {
+	http.ResponseWriter
+
+	threshold  int
+	statusCode int
+	buf        []byte
+	gzipWriter *gzip.Writer
+	closed     bool
+}
+
+var _ http.ResponseWriter = &compressionWriter{}
+var _ http.Flusher = &compressionWriter{}
+
+// newResponseWriter 根据请求的 Accept-Encoding 返回可能压缩响应的 http.ResponseWriter 和写完后需要调用的关闭方法
+func (h *CacheProxyHandler) newResponseWriter(w http.ResponseWriter, req *http.Request) (http.ResponseWriter, func() error) {
+	if h.disableCompression || !acceptsGzip(req) {
+		return w, func() error { return nil }
+	}
+	cw := newCompressionWriter(w, gzipThresholdBytes)
+	return cw, cw.Close
+}
+
+// newCompressionWriter 创建 compressionWriter
+func newCompressionWriter(w http.ResponseWriter, threshold int) *compressionWriter {
+	return &compressionWriter{
+		ResponseWriter: w,
+		threshold:      threshold,
+		statusCode:     http.StatusOK,
+	}
+}
+
+// WriteHeader 记录响应状态码，直到确定是否压缩后再写出
+func (w *compressionWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+// Write 写响应体
+func (w *compressionWriter) Write(p []byte) (int, error) {
+	if w.gzipWriter != nil {
+		return w.gzipWriter.Write(p)
+	}
+	if len(w.buf)+len(p) < w.threshold {
+		w.buf = append(w.buf, p...)
+		return len(p), nil
+	}
+
+	// 超过阈值，开始压缩
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	w.gzipWriter, _ = gzip.NewWriterLevel(w.ResponseWriter, gzipLevel)
+	if len(w.buf) > 0 {
+		if _, err := w.gzipWriter.Write(w.buf); err != nil {
+			return 0, err
+		}
+		w.buf = nil
+	}
+	return w.gzipWriter.Write(p)
+}
+
+// Flush 将已压缩的内容写到响应，未开始压缩时不做任何事
+func (w *compressionWriter) Flush() {
+	if w.gzipWriter == nil {
+		return
+	}
+	_ = w.gzipWriter.Flush()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close 结束写响应，未超过阈值时原样写出缓存的内容
+func (w *compressionWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.gzipWriter != nil {
+		return w.gzipWriter.Close()
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, err := w.ResponseWriter.Write(w.buf)
+	return err
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAcceptsGzip 测试判断请求是否接受 gzip 编码
+func TestAcceptsGzip(t *testing.T) {
+	for header, expected := range map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"deflate, gzip":     true,
+		"GZIP;q=0.5":        true,
+		"gzip;q=0":          false,
+		"deflate, identity": false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+		if header != "" {
+			req.Header.Set("Accept-Encoding", header)
+		}
+		if ret := acceptsGzip(req); ret != expected {
+			t.Errorf("%q: expected %t, got: %t", header, expected, ret)
+		}
+	}
+}
+
+// TestCompressionWriter 测试根据响应大小决定是否压缩
+func TestCompressionWriter(t *testing.T) {
+	// 未超过阈值，不压缩
+	rec := httptest.NewRecorder()
+	w := newCompressionWriter(rec, 16)
+	w.WriteHeader(http.StatusNotFound)
+	_, _ = w.Write([]byte("short"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "short" {
+		t.Errorf("unexpected response: %d, %v, %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	// 分多次写入超过阈值，压缩
+	rec = httptest.NewRecorder()
+	w = newCompressionWriter(rec, 16)
+	expected := bytes.Repeat([]byte("0123456789"), 10)
+	for i := 0; i < len(expected); i += 10 {
+		_, _ = w.Write(expected[i : i+10])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("unexpected response: %d, %v", rec.Code, rec.Header())
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("create gzip reader error: %v", err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read gzip body error: %v", err)
+	}
+	if !bytes.Equal(body, expected) {
+		t.Errorf("expected body %q, got: %q", expected, body)
+	}
+}
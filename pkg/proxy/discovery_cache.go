@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// discoveryCacheMaxAge 缓存的 discovery 和 OpenAPI 文档超过该时间后使用前先通过 ETag 向 APIServer 确认
+const discoveryCacheMaxAge = 10 * time.Minute
+
+// NewDiscoveryCacheHandler 创建缓存 discovery 和 OpenAPI 文档的 HTTP 处理器
+//
+// 缓存无法满足的请求交给 passthrough 处理。 apiWatcher 不为空时， CRD 或 APIService 变化后清空缓存
+func NewDiscoveryCacheHandler(
+	apiProxyPrefix string,
+	passthrough http.Handler,
+	apiWatcher *APIWatcher,
+) *DiscoveryCacheHandler {
+	h := &DiscoveryCacheHandler{
+		pathPrefix:  strings.TrimSuffix(apiProxyPrefix, "/"),
+		passthrough: passthrough,
+		maxAge:      discoveryCacheMaxAge,
+		entries:     make(map[string]*discoveryCacheEntry),
+	}
+	if apiWatcher != nil {
+		apiWatcher.AddHandler(func(event APIChangeEvent) {
+			h.Invalidate()
+		})
+	}
+	return h
+}
+
+// DiscoveryCacheHandler 缓存 discovery （包括聚合 discovery ）和 OpenAPI v2 、 v3 文档的 HTTP 处理器
+type DiscoveryCacheHandler struct {
+	pathPrefix  string
+	passthrough http.Handler
+	maxAge      time.Duration
+
+	lock    sync.RWMutex
+	entries map[string]*discoveryCacheEntry
+	// 每次清空缓存后加一，避免清空前开始获取的响应写入缓存
+	generation uint64
+}
+
+// discoveryCacheEntry 缓存的响应
+type discoveryCacheEntry struct {
+	header      http.Header
+	body        []byte
+	validatedAt time.Time
+}
+
+var _ http.Handler = &DiscoveryCacheHandler{}
+
+// IsCached 判断请求是否是可缓存的 discovery 或 OpenAPI 请求
+func (h *DiscoveryCacheHandler) IsCached(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	path, ok := strings.CutPrefix(req.URL.Path, h.pathPrefix)
+	if !ok {
+		return false
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch segments[0] {
+	case "api":
+		// /api 、 /api/{version}
+		return len(segments) <= 2
+	case "apis":
+		// /apis 、 /apis/{group} 、 /apis/{group}/{version}
+		return len(segments) <= 3
+	case "openapi":
+		// /openapi/v2 、 /openapi/v3 、 /openapi/v3/{path}
+		return len(segments) >= 2 && (segments[1] == "v2" || segments[1] == "v3")
+	}
+	return false
+}
+
+// Invalidate 清空缓存
+func (h *DiscoveryCacheHandler) Invalidate() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.entries = make(map[string]*discoveryCacheEntry)
+	h.generation++
+}
+
+// ServeHTTP 处理 HTTP 请求
+func (h *DiscoveryCacheHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := discoveryCacheKey(req)
+
+	h.lock.RLock()
+	entry := h.entries[key]
+	generation := h.generation
+	h.lock.RUnlock()
+
+	if entry != nil && time.Since(entry.validatedAt) > h.maxAge {
+		// 缓存过旧，向 APIServer 确认
+		entry = h.revalidate(req, key, entry)
+	}
+	if entry == nil {
+		// 没有缓存，获取完整的响应
+		fetchReq := req.Clone(req.Context())
+		fetchReq.Header.Del("If-None-Match")
+		rec := newResponseRecorder()
+		h.passthrough.ServeHTTP(rec, fetchReq)
+		if rec.code != http.StatusOK {
+			rec.writeTo(w)
+			return
+		}
+		logr.FromContextOrDiscard(req.Context()).V(1).Info(fmt.Sprintf("cache discovery response %s", req.URL.Path))
+		entry = &discoveryCacheEntry{header: rec.header, body: rec.body.Bytes(), validatedAt: time.Now()}
+		h.lock.Lock()
+		if h.generation == generation {
+			h.entries[key] = entry
+		}
+		h.lock.Unlock()
+	}
+
+	// 客户端缓存的版本与缓存一致
+	if etag := entry.header.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	for k, v := range entry.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(entry.body)
+}
+
+// revalidate 通过 ETag 向 APIServer 确认缓存是否仍然有效，有效时返回更新了确认时间的缓存，否则删除缓存并返回 nil
+func (h *DiscoveryCacheHandler) revalidate(req *http.Request, key string, entry *discoveryCacheEntry) *discoveryCacheEntry {
+	etag := entry.header.Get("ETag")
+	if etag != "" {
+		revalidateReq := req.Clone(req.Context())
+		revalidateReq.Header.Set("If-None-Match", etag)
+		rec := newResponseRecorder()
+		h.passthrough.ServeHTTP(rec, revalidateReq)
+		if rec.code == http.StatusNotModified {
+			validated := &discoveryCacheEntry{header: entry.header, body: entry.body, validatedAt: time.Now()}
+			h.lock.Lock()
+			if h.entries[key] == entry {
+				h.entries[key] = validated
+			}
+			h.lock.Unlock()
+			return validated
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.entries[key] == entry {
+		delete(h.entries, key)
+	}
+	return nil
+}
+
+// discoveryCacheKey 返回请求的缓存键
+//
+// 聚合 discovery 等通过 Accept 协商响应格式，压缩与否取决于 Accept-Encoding ，因此都作为键的一部分
+func discoveryCacheKey(req *http.Request) string {
+	return strings.Join([]string{
+		req.URL.Path,
+		req.URL.RawQuery,
+		req.Header.Get("Accept"),
+		req.Header.Get("Accept-Encoding"),
+	}, "\n")
+}
+
+// responseRecorder 记录响应的 http.ResponseWriter
+type responseRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+var _ http.ResponseWriter = &responseRecorder{}
+var _ http.Flusher = &responseRecorder{}
+
+// newResponseRecorder 创建 responseRecorder
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: make(http.Header),
+		code:   http.StatusOK,
+	}
+}
+
+// Header 返回响应头
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+// Write 写响应体
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	return rec.body.Write(p)
+}
+
+// WriteHeader 记录响应状态码
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	rec.code = statusCode
+}
+
+// Flush 内容都记录在内存中，不需要做任何事
+func (rec *responseRecorder) Flush() {}
+
+// writeTo 将记录的响应写到 w
+func (rec *responseRecorder) writeTo(w http.ResponseWriter) {
+	for k, v := range rec.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.code)
+	_, _ = w.Write(rec.body.Bytes())
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestDiscoveryCacheHandler 测试缓存 discovery 文档
+func TestDiscoveryCacheHandler(t *testing.T) {
+	requests := 0
+	body := "v1"
+	passthrough := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		etag := `"` + body + `"`
+		w.Header().Set("ETag", etag)
+		if req.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	})
+	h := NewDiscoveryCacheHandler("/", passthrough, nil)
+
+	for path, expected := range map[string]bool{
+		"/api":                      true,
+		"/api/v1":                   true,
+		"/api/v1/pods":              false,
+		"/apis":                     true,
+		"/apis/apps/v1":             true,
+		"/apis/apps/v1/deployments": false,
+		"/openapi/v3/apis/apps/v1":  true,
+		"/version":                  false,
+	} {
+		if ret := h.IsCached(httptest.NewRequest(http.MethodGet, path, nil)); ret != expected {
+			t.Errorf("%s: expected %t, got: %t", path, expected, ret)
+		}
+	}
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/apis", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 第二次请求命中缓存
+	if rec := get(""); rec.Code != http.StatusOK || rec.Body.String() != "v1" {
+		t.Fatalf("unexpected response: %d, %q", rec.Code, rec.Body.String())
+	}
+	if rec := get(""); rec.Code != http.StatusOK || rec.Body.String() != "v1" || requests != 1 {
+		t.Errorf("unexpected response: %d, %q, requests: %d", rec.Code, rec.Body.String(), requests)
+	}
+	// 客户端的 ETag 与缓存一致
+	if rec := get(`"v1"`); rec.Code != http.StatusNotModified || requests != 1 {
+		t.Errorf("expected %d, got: %d, requests: %d", http.StatusNotModified, rec.Code, requests)
+	}
+
+	// 过期后通过 ETag 确认
+	h.maxAge = 0
+	time.Sleep(time.Millisecond)
+	if rec := get(""); rec.Body.String() != "v1" || requests != 2 {
+		t.Errorf("unexpected response: %q, requests: %d", rec.Body.String(), requests)
+	}
+	body = "v2"
+	time.Sleep(time.Millisecond)
+	if rec := get(""); rec.Body.String() != "v2" || requests != 4 {
+		t.Errorf("unexpected response: %q, requests: %d", rec.Body.String(), requests)
+	}
+
+	// 清空后重新获取
+	h.maxAge = time.Hour
+	body = "v3"
+	h.Invalidate()
+	if rec := get(""); rec.Body.String() != "v3" || requests != 5 {
+		t.Errorf("unexpected response: %q, requests: %d", rec.Body.String(), requests)
+	}
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// informerSyncTimeout 等待 informer 同步的超时时间，超时后该资源暂时直连
+var informerSyncTimeout = 30 * time.Second
+
+// passthroughCoolDown 无法建立 informer 的资源暂时直连的时长，之后再次尝试建立 informer
+const passthroughCoolDown = 5 * time.Minute
+
+// passthroughResources 记录因无法建立 informer （比如没有权限列出资源）而暂时直连的资源（及命名空间）
+type passthroughResources struct {
+	lock    sync.Mutex
+	entries map[watchCacheKey]passthroughEntry
+}
+
+// passthroughEntry 暂时直连的资源的记录
+type passthroughEntry struct {
+	// 直连截止时间
+	until time.Time
+	// 无法建立 informer 的原因
+	reason error
+}
+
+// Add 在接下来的 coolDown 时间内直连指定资源，返回包含原因的 errPassthrough
+func (r *passthroughResources) Add(key watchCacheKey, coolDown time.Duration, reason error) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.entries == nil {
+		r.entries = make(map[watchCacheKey]passthroughEntry)
+	}
+	r.entries[key] = passthroughEntry{until: time.Now().Add(coolDown), reason: reason}
+	return newResourcePassthroughError(key, reason)
+}
+
+// Check 检查指定资源是否需要直连，需要时返回包含原因的 errPassthrough ，否则返回 nil
+func (r *passthroughResources) Check(key watchCacheKey) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entry, ok := r.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.until) {
+		// 冷却结束，重新尝试建立 informer
+		delete(r.entries, key)
+		return nil
+	}
+	return newResourcePassthroughError(key, entry.reason)
+}
+
+// newResourcePassthroughError 创建资源无法建立 informer 时的 errPassthrough
+func newResourcePassthroughError(key watchCacheKey, reason error) error {
+	return fmt.Errorf("%w: can not establish informer for %s: %w", errPassthrough, key, reason)
+}
+
+// probeResource 尝试从 APIServer 列出一个资源对象，确认能够建立该资源（在指定命名空间）的 informer
+//
+// 没有权限（ 401 、 403 ）或资源不存在（ 404 ）时 informer 会一直重试而无法同步，需要提前发现
+func (h *CacheProxyHandler) probeResource(ctx context.Context, key watchCacheKey) error {
+	_, err := h.metadataClient.Resource(key.gvr).Namespace(key.namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("list %s error: %w", key, err)
+	}
+	return nil
+}
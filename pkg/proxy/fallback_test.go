@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// TestPassthroughResources 测试记录暂时直连的资源
+func TestPassthroughResources(t *testing.T) {
+	r := &passthroughResources{}
+	pods := watchCacheKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}}
+	secrets := watchCacheKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}}
+
+	if err := r.Check(pods); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := r.Add(secrets, time.Hour, errors.New("forbidden")); !errors.Is(err, errPassthrough) {
+		t.Errorf("expected errPassthrough, got: %v", err)
+	}
+	if err := r.Check(secrets); !errors.Is(err, errPassthrough) {
+		t.Errorf("expected errPassthrough, got: %v", err)
+	}
+	if err := r.Check(pods); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// 冷却结束
+	_ = r.Add(secrets, 0, errors.New("forbidden"))
+	time.Sleep(time.Millisecond)
+	if err := r.Check(secrets); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestProbeResource 测试确认能否列出资源
+func TestProbeResource(t *testing.T) {
+	client := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	client.PrependReactor("list", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		gvr := action.GetResource()
+		if gvr.Resource == "secrets" && action.GetNamespace() != "default" {
+			return true, nil, apierrors.NewForbidden(gvr.GroupResource(), "", errors.New("no permission"))
+		}
+		return true, &metav1.List{}, nil
+	})
+	h := &CacheProxyHandler{metadataClient: client}
+
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	if err := h.probeResource(context.Background(), watchCacheKey{gvr: pods}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := h.probeResource(context.Background(), watchCacheKey{gvr: secrets})
+	if !apierrors.IsForbidden(err) {
+		t.Errorf("expected forbidden error, got: %v", err)
+	}
+	if err := h.probeResource(context.Background(), watchCacheKey{gvr: secrets, namespace: "default"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
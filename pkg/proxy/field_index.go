@@ -3,37 +3,72 @@ package proxy
 import (
 	"context"
 	"fmt"
-	"strconv"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/go-logr/logr"
-	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/cache"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/jsonpath"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // IndexFieldsForObject 为对象设置字段索引
-func IndexFieldsForObject(ctx context.Context, c cache.Cache, obj client.Object) error {
+//
+// 内置资源支持的字段与 APIServer 一致（见 SelectableFields ），其它资源仅支持 metadata 字段。
+// extraFields 为额外基于 JSONPath 索引的字段（比如 CRD 中声明的或用户配置的），与已有索引重名的字段会被忽略
+func IndexFieldsForObject(
+	ctx context.Context,
+	c client.FieldIndexer,
+	scheme *runtime.Scheme,
+	gvk schema.GroupVersionKind,
+	obj client.Object,
+	extraFields []apiextensionsv1.SelectableField,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+
 	// 添加 metadata 字段索引
 	if err := IndexFieldsForObjectMeta(ctx, c, obj); err != nil {
 		return err
 	}
 
-	// 添加额外字段索引
-	switch obj.(type) {
-	case *appsv1.ReplicaSet:
-		return IndexFieldsForAppsV1ReplicaSet(ctx, c)
-	case *corev1.Event:
-		return IndexFieldsForCoreV1Event(ctx, c)
-	case *corev1.Pod:
-		return IndexFieldsForCoreV1Pod(ctx, c)
+	// 添加内置资源的额外字段索引
+	indexed := sets.New("metadata.name", "metadata.namespace")
+	indexer := newSelectableFieldsIndexer(scheme, gvk)
+	for _, field := range SelectableFieldNames(scheme, gvk) {
+		if indexed.Has(field) {
+			continue
+		}
+		logger.V(1).Info(fmt.Sprintf("set index field %q for %s", field, gvk))
+		if err := c.IndexField(ctx, obj, field, indexer.IndexerFunc(field)); err != nil {
+			return err
+		}
+		indexed.Insert(field)
 	}
 
-	return nil
+	// 添加基于 JSONPath 的额外字段索引
+	jsonPathFields := make([]apiextensionsv1.SelectableField, 0, len(extraFields))
+	for _, selectableField := range extraFields {
+		field := strings.TrimPrefix(selectableField.JSONPath, ".")
+		if indexed.Has(field) {
+			logger.V(1).Info(fmt.Sprintf("index field %q for %s already exists, skipped", field, gvk))
+			continue
+		}
+		jsonPathFields = append(jsonPathFields, selectableField)
+		indexed.Insert(field)
+	}
+	return IndexFieldsForJSONPaths(ctx, c, gvk, obj, jsonPathFields)
 }
 
 // IndexFieldsForObjectMeta 为任意资源添加 metadata 字段索引
-func IndexFieldsForObjectMeta(ctx context.Context, c cache.Cache, obj client.Object) error {
+func IndexFieldsForObjectMeta(ctx context.Context, c client.FieldIndexer, obj client.Object) error {
 	logger := logr.FromContextOrDiscard(ctx)
 	logger.V(1).Info(fmt.Sprintf("set index field \"metadata.name\" for %T", obj))
 	if err := c.IndexField(ctx, obj, "metadata.name", getObjectNames); err != nil {
@@ -56,136 +91,181 @@ func getObjectNamespaces(obj client.Object) []string {
 	return []string{obj.GetNamespace()}
 }
 
-// IndexFieldsForCoreV1Pod 为 corev1.Pod 设置字段索引
-func IndexFieldsForCoreV1Pod(ctx context.Context, c cache.Cache) error {
+// IndexFieldsForJSONPaths 为对象添加基于 JSONPath 的字段索引
+//
+// 字段名为去掉开头 "." 的 JSONPath ，与 APIServer 处理 CRD 中声明的可选字段（ selectableFields ）一致
+func IndexFieldsForJSONPaths(
+	ctx context.Context,
+	c client.FieldIndexer,
+	gvk schema.GroupVersionKind,
+	obj client.Object,
+	selectableFields []apiextensionsv1.SelectableField,
+) error {
 	logger := logr.FromContextOrDiscard(ctx)
-	for _, field := range []string{
-		"spec.nodeName",
-		"spec.restartPolicy",
-		"spec.schedulerName",
-		"spec.serviceAccountName",
-		"spec.hostNetwork",
-		"status.podIP",
-		"status.phase",
-		"status.nominatedNodeName",
-	} {
-		logger.V(1).Info(fmt.Sprintf("set index field %q for *v1.Pod", field))
-		if err := c.IndexField(ctx, &corev1.Pod{}, field, getCoreV1PodField(field)); err != nil {
+	for _, selectableField := range selectableFields {
+		field := strings.TrimPrefix(selectableField.JSONPath, ".")
+		indexerFunc, err := newJSONPathIndexerFunc(selectableField.JSONPath)
+		if err != nil {
+			return fmt.Errorf("parse json path %q error: %w", selectableField.JSONPath, err)
+		}
+		logger.V(1).Info(fmt.Sprintf("set index field %q for %s", field, gvk))
+		if err := c.IndexField(ctx, obj, field, indexerFunc); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// getCoreV1PodField 获取 corev1.Pod 字段方法
-func getCoreV1PodField(field string) client.IndexerFunc {
+// newJSONPathIndexerFunc 创建基于 JSONPath 的字段索引方法
+//
+// 字段值为 JSONPath 唯一结果的字符串形式，没有结果时为空字符串，有多个结果或结果不是标量（对象或数组）时不索引
+func newJSONPathIndexerFunc(jsonPath string) (client.IndexerFunc, error) {
+	parser := jsonpath.New("field")
+	parser.AllowMissingKeys(true)
+	if err := parser.Parse("{" + jsonPath + "}"); err != nil {
+		return nil, err
+	}
+
+	// JSONPath 解析器不能并发使用
+	var lock sync.Mutex
 	return func(obj client.Object) []string {
-		pod, ok := obj.(*corev1.Pod)
-		if !ok || pod == nil {
+		var content map[string]interface{}
+		if u, ok := obj.(runtime.Unstructured); ok {
+			content = u.UnstructuredContent()
+		} else {
+			var err error
+			if content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj); err != nil {
+				return nil
+			}
+		}
+
+		lock.Lock()
+		results, err := parser.FindResults(content)
+		lock.Unlock()
+		if err != nil {
 			return nil
 		}
-		val := ""
-		switch field {
-		case "spec.nodeName":
-			val = pod.Spec.NodeName
-		case "spec.restartPolicy":
-			val = string(pod.Spec.RestartPolicy)
-		case "spec.schedulerName":
-			val = pod.Spec.SchedulerName
-		case "spec.serviceAccountName":
-			val = pod.Spec.ServiceAccountName
-		case "spec.hostNetwork":
-			val = strconv.FormatBool(pod.Spec.HostNetwork)
-		case "status.podIP":
-			val = pod.Status.PodIP
-		case "status.phase":
-			val = string(pod.Status.Phase)
-		case "status.nominatedNodeName":
-			val = pod.Status.NominatedNodeName
-		default:
+		if len(results) == 0 || len(results[0]) == 0 {
+			return []string{""}
+		}
+		if len(results) > 1 || len(results[0]) > 1 {
 			return nil
 		}
-		return []string{val}
-	}
+		value := results[0][0].Interface()
+		if value == nil {
+			return []string{""}
+		}
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+			// 只索引字符串、数字和布尔值等标量，对象和数组不索引
+			return nil
+		}
+		return []string{fmt.Sprint(value)}
+	}, nil
 }
 
-// IndexFieldsForCoreV1Event 为 corev1.Event 设置字段索引
-func IndexFieldsForCoreV1Event(ctx context.Context, c cache.Cache) error {
-	logger := logr.FromContextOrDiscard(ctx)
-	for _, field := range []string{
-		"involvedObject.kind",
-		"involvedObject.namespace",
-		"involvedObject.name",
-		"involvedObject.uid",
-		"involvedObject.apiVersion",
-		"involvedObject.resourceVersion",
-		"involvedObject.fieldPath",
-		"reason",
-		"reportingComponent",
-		"source",
-		"type",
-	} {
-		logger.V(1).Info(fmt.Sprintf("set index field %q for *v1.Event", field))
-		if err := c.IndexField(ctx, &corev1.Event{}, field, getCoreV1EventField(field)); err != nil {
-			return err
-		}
+// newFieldIndexRecorder 创建 fieldIndexRecorder
+func newFieldIndexRecorder() *fieldIndexRecorder {
+	return &fieldIndexRecorder{
+		indexers: toolscache.Indexers{},
 	}
+}
+
+// fieldIndexRecorder 仅记录字段索引的 client.FieldIndexer
+//
+// 记录的索引方法与 controller-runtime 字段索引一致，可以直接添加到 informer 上，
+// 避免通过 cache.Cache 设置索引时以阻塞的方式启动 informer
+type fieldIndexRecorder struct {
+	indexers toolscache.Indexers
+}
+
+var _ client.FieldIndexer = &fieldIndexRecorder{}
+
+// IndexField 记录字段索引对应的索引方法
+func (r *fieldIndexRecorder) IndexField(
+	_ context.Context,
+	_ client.Object,
+	field string,
+	extractValue client.IndexerFunc,
+) error {
+	r.indexers[fieldIndexName(field)] = newFieldIndexFunc(extractValue)
 	return nil
 }
 
-// getCoreV1EventField 获取 corev1.Event 字段方法
-func getCoreV1EventField(field string) client.IndexerFunc {
-	return func(obj client.Object) []string {
-		event, ok := obj.(*corev1.Event)
-		if !ok || event == nil {
-			return nil
+// Indexers 返回记录的索引方法
+func (r *fieldIndexRecorder) Indexers() toolscache.Indexers {
+	return r.indexers
+}
+
+// newFieldIndexFunc 基于字段值提取方法创建索引方法
+//
+// 与 controller-runtime 字段索引一致，每个值既以对象所在命名空间索引，也以跨所有命名空间的键索引
+func newFieldIndexFunc(extractValue client.IndexerFunc) toolscache.IndexFunc {
+	return func(objRaw interface{}) ([]string, error) {
+		obj, ok := objRaw.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("object of type %T is not an Object", objRaw)
+		}
+		namespace := obj.GetNamespace()
+		rawValues := extractValue(obj)
+		values := make([]string, 0, len(rawValues)*2)
+		for _, value := range rawValues {
+			values = append(values, namespacedIndexKey(namespace, value))
 		}
-		val := ""
-		switch field {
-		case "involvedObject.kind":
-			val = event.InvolvedObject.Kind
-		case "involvedObject.namespace":
-			val = event.InvolvedObject.Namespace
-		case "involvedObject.name":
-			val = event.InvolvedObject.Name
-		case "involvedObject.uid":
-			val = string(event.InvolvedObject.UID)
-		case "involvedObject.apiVersion":
-			val = event.InvolvedObject.APIVersion
-		case "involvedObject.resourceVersion":
-			val = event.InvolvedObject.ResourceVersion
-		case "involvedObject.fieldPath":
-			val = event.InvolvedObject.FieldPath
-		case "reason":
-			val = event.Reason
-		case "reportingComponent":
-			val = event.ReportingController
-		case "source":
-			val = event.Source.Component
-			if val == "" {
-				val = event.ReportingController
+		if namespace != "" {
+			for _, value := range rawValues {
+				values = append(values, namespacedIndexKey("", value))
 			}
-		case "type":
-			val = event.Type
-		default:
-			return nil
 		}
-		return []string{val}
+		return values, nil
 	}
 }
 
-// IndexFieldsForAppsV1ReplicaSet 为 appsv1.ReplicaSet 设置字段索引
-func IndexFieldsForAppsV1ReplicaSet(ctx context.Context, c cache.Cache) error {
-	logger := logr.FromContextOrDiscard(ctx)
-	logger.V(1).Info("set index field \"status.replicas\" for *v1.ReplicaSet")
-	if err := c.IndexField(ctx, &appsv1.ReplicaSet{}, "status.replicas", func(obj client.Object) []string {
-		rs, ok := obj.(*appsv1.ReplicaSet)
-		if !ok || rs == nil {
-			return nil
+// fieldIndexName 返回字段索引名
+func fieldIndexName(field string) string {
+	return "field:" + field
+}
+
+// namespacedIndexKey 返回字段索引键，命名空间为空时返回跨所有命名空间的索引键
+//
+// 与 controller-runtime 字段索引的键格式一致
+func namespacedIndexKey(namespace, value string) string {
+	if namespace == "" {
+		namespace = "__all_namespaces"
+	}
+	return namespace + "/" + value
+}
+
+// isEqualityOperator 判断是否为相等操作符
+func isEqualityOperator(op selection.Operator) bool {
+	return op == selection.Equals || op == selection.DoubleEquals
+}
+
+// matchFieldSelector 基于字段索引判断对象是否匹配字段选择器
+func matchFieldSelector(indexers toolscache.Indexers, obj runtime.Object, selector fields.Selector) (bool, error) {
+	if selector == nil || selector.Empty() {
+		return true, nil
+	}
+	for _, req := range selector.Requirements() {
+		indexFunc, ok := indexers[fieldIndexName(req.Field)]
+		if !ok {
+			return false, fmt.Errorf("field label not supported: %s", req.Field)
+		}
+		values, err := indexFunc(obj)
+		if err != nil {
+			return false, err
+		}
+		matched := slices.Contains(values, namespacedIndexKey("", req.Value))
+		switch req.Operator {
+		case selection.Equals, selection.DoubleEquals:
+		case selection.NotEquals:
+			matched = !matched
+		default:
+			return false, fmt.Errorf("unsupported operator %q in field selector", req.Operator)
+		}
+		if !matched {
+			return false, nil
 		}
-		return []string{strconv.Itoa(int(rs.Status.Replicas))}
-	}); err != nil {
-		return err
 	}
-	return nil
+	return true, nil
 }
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// FieldIndexConfig 用户自定义字段索引配置
+//
+// 例：
+//
+//	resources:
+//	- apiVersion: apps/v1
+//	  kind: Deployment
+//	  selectableFields:
+//	  - jsonPath: .spec.template.spec.nodeSelector.disktype
+//	- apiVersion: example.com/v1
+//	  kind: Foo
+//	  selectableFields:
+//	  - jsonPath: .status.cluster
+type FieldIndexConfig struct {
+	// 各资源的自定义字段索引
+	Resources []ResourceFieldIndexConfig `json:"resources,omitempty"`
+}
+
+// ResourceFieldIndexConfig 一种资源的自定义字段索引配置
+type ResourceFieldIndexConfig struct {
+	// 资源 API 版本，比如 apps/v1
+	APIVersion string `json:"apiVersion"`
+	// 资源类型，比如 Deployment
+	Kind string `json:"kind"`
+	// 可用于字段选择器的字段，与 CRD 的 selectableFields 格式一致，字段名为去掉开头 "." 的 JSONPath 。
+	// 与 CRD 一样只支持字符串、数字和布尔值等标量字段，值为对象或数组的对象不会被字段选择器匹配
+	SelectableFields []apiextensionsv1.SelectableField `json:"selectableFields,omitempty"`
+}
+
+// LoadFieldIndexConfig 从 YAML 或 JSON 文件加载用户自定义字段索引配置，返回各类型需要额外索引的字段
+func LoadFieldIndexConfig(path string) (map[schema.GroupVersionKind][]apiextensionsv1.SelectableField, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read field index config file %q error: %w", path, err)
+	}
+	config := &FieldIndexConfig{}
+	if err := yaml.UnmarshalStrict(raw, config); err != nil {
+		return nil, fmt.Errorf("decode field index config file %q error: %w", path, err)
+	}
+	return config.FieldIndexes()
+}
+
+// FieldIndexes 校验配置并返回各类型需要额外索引的字段
+func (c *FieldIndexConfig) FieldIndexes() (map[schema.GroupVersionKind][]apiextensionsv1.SelectableField, error) {
+	ret := make(map[schema.GroupVersionKind][]apiextensionsv1.SelectableField, len(c.Resources))
+	for i, res := range c.Resources {
+		gv, err := schema.ParseGroupVersion(res.APIVersion)
+		if err != nil {
+			return nil, fmt.Errorf("resources[%d]: invalid apiVersion %q: %w", i, res.APIVersion, err)
+		}
+		if gv.Version == "" || res.Kind == "" {
+			return nil, fmt.Errorf("resources[%d]: apiVersion and kind must be specified", i)
+		}
+		gvk := gv.WithKind(res.Kind)
+		for j, field := range res.SelectableFields {
+			if _, err := newJSONPathIndexerFunc(field.JSONPath); err != nil {
+				return nil, fmt.Errorf("resources[%d].selectableFields[%d]: invalid jsonPath %q: %w", i, j, field.JSONPath, err)
+			}
+			ret[gvk] = append(ret[gvk], field)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TestLoadFieldIndexConfig 测试加载用户自定义字段索引配置
+func TestLoadFieldIndexConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "valid.yaml")
+	if err := os.WriteFile(path, []byte(`resources:
+- apiVersion: apps/v1
+  kind: Deployment
+  selectableFields:
+  - jsonPath: .spec.template.spec.nodeSelector.disktype
+- apiVersion: v1
+  kind: Pod
+  selectableFields:
+  - jsonPath: .spec.priorityClassName
+`), 0o644); err != nil {
+		t.Fatalf("write config file error: %v", err)
+	}
+	fieldIndexes, err := LoadFieldIndexConfig(path)
+	if err != nil {
+		t.Fatalf("load config error: %v", err)
+	}
+	deployFields := fieldIndexes[schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}]
+	if len(deployFields) != 1 || deployFields[0].JSONPath != ".spec.template.spec.nodeSelector.disktype" {
+		t.Errorf("unexpected fields for Deployment: %v", deployFields)
+	}
+	if podFields := fieldIndexes[schema.GroupVersionKind{Version: "v1", Kind: "Pod"}]; len(podFields) != 1 {
+		t.Errorf("unexpected fields for Pod: %v", podFields)
+	}
+
+	for name, content := range map[string]string{
+		"invalid-json-path.yaml": "resources:\n- apiVersion: v1\n  kind: Pod\n  selectableFields:\n  - jsonPath: .spec[\n",
+		"missing-kind.yaml":      "resources:\n- apiVersion: v1\n",
+		"unknown-field.yaml":     "resources:\n- apiVersion: v1\n  kind: Pod\n  fields: []\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write config file error: %v", err)
+		}
+		if _, err := LoadFieldIndexConfig(path); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestJSONPathIndexerFunc 测试基于 JSONPath 的字段索引方法
+func TestJSONPathIndexerFunc(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"color":    "red",
+			"replicas": int64(3),
+			"items":    []interface{}{"a", "b"},
+			"enabled":  true,
+		},
+	}}
+	for jsonPath, expected := range map[string][]string{
+		".spec.color":    {"red"},
+		".spec.replicas": {"3"},
+		".spec.missing":  {""},
+		".spec.enabled":  {"true"},
+		".spec.items[*]": nil,
+		// 对象和数组不索引
+		".spec.items": nil,
+		".spec":       nil,
+	} {
+		indexerFunc, err := newJSONPathIndexerFunc(jsonPath)
+		if err != nil {
+			t.Fatalf("%q: new indexer func error: %v", jsonPath, err)
+		}
+		if values := indexerFunc(obj); !slices.Equal(values, expected) {
+			t.Errorf("%q: expected %v, got: %v", jsonPath, expected, values)
+		}
+	}
+}
+
+// TestFieldIndexFunc 测试基于字段值提取方法创建的索引方法
+func TestFieldIndexFunc(t *testing.T) {
+	indexFunc := newFieldIndexFunc(getObjectNames)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetName("foo")
+	values, err := indexFunc(obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"__all_namespaces/foo"}; !slices.Equal(values, expected) {
+		t.Errorf("expected %v, got: %v", expected, values)
+	}
+
+	obj.SetNamespace("default")
+	values, err = indexFunc(obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"default/foo", "__all_namespaces/foo"}; !slices.Equal(values, expected) {
+		t.Errorf("expected %v, got: %v", expected, values)
+	}
+}
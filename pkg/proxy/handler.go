@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -21,6 +22,7 @@ func NewProxyHandler(
 	mapper meta.RESTMapper,
 	keepalive time.Duration,
 	appendLocationPath bool,
+	cacheOpts CacheOptions,
 	notify func(*http.Request),
 ) (http.Handler, error) {
 	logger := logr.FromContextOrDiscard(ctx)
@@ -31,17 +33,27 @@ func NewProxyHandler(
 		return nil, err
 	}
 
+	// 监听 API 变化
+	apiWatcher, err := NewAPIWatcherForConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// 缓存 handler
-	cache, err := NewCacheProxyHandler(ctx, cfg, mapper, apiProxyPrefix)
+	// 使用动态的 RESTMapper ，以便启动后新安装的资源也能被缓存
+	mapper = NewDynamicRESTMapper(mapper, apiWatcher)
+	cache, err := NewCacheProxyHandler(ctx, cfg, mapper, apiWatcher, apiProxyPrefix, passthrough, cacheOpts)
 	if err != nil {
 		return nil, err
 	}
 
 	h := http.Handler(&proxyHandler{
-		Handler: passthrough,
-		logger:  logger,
-		cache:   cache, // 缓存 handler
-		notify:  notify,
+		Handler:    passthrough,
+		logger:     logger,
+		cache:      cache, // 缓存 handler
+		discovery:  NewDiscoveryCacheHandler(apiProxyPrefix, passthrough, apiWatcher),
+		statusPath: strings.TrimSuffix(apiProxyPrefix, "/") + CacheStatusPath,
+		notify:     notify,
 	})
 
 	// 添加过滤器
@@ -60,6 +72,8 @@ type proxyHandler struct {
 
 	cacheFilterHandler http.Handler
 	cache              *CacheProxyHandler
+	discovery          *DiscoveryCacheHandler
+	statusPath         string
 	notify             func(*http.Request)
 }
 
@@ -74,6 +88,26 @@ func (h *proxyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		h.notify(req)
 	}
 
+	if h.cache != nil && req.URL.Path == h.statusPath {
+		// 缓存状态
+		h.cache.ServeStatus(w, req)
+		return
+	}
+
+	if h.cache != nil && h.cache.IsWrite(req) {
+		// 直连，并记录写入的资源版本
+		logger.V(1).Info(fmt.Sprintf("PASSTHROUGH %s %s", req.Method, req.RequestURI))
+		h.cache.ServeWrite(w, req)
+		return
+	}
+
+	if h.discovery != nil && h.discovery.IsCached(req) {
+		// discovery 和 OpenAPI 文档
+		logger.V(1).Info(fmt.Sprintf("DISCOVERY   %s %s", req.Method, req.RequestURI))
+		h.discovery.ServeHTTP(w, req)
+		return
+	}
+
 	if h.cache == nil || !h.cache.IsCached(req) {
 		// 直连
 		logger.V(1).Info(fmt.Sprintf("PASSTHROUGH %s %s", req.Method, req.RequestURI))
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// minInformerEvictionInterval 检查空闲 informer 的最小间隔
+	minInformerEvictionInterval = time.Second
+	// memoryLimitCheckInterval 检查缓存内存占用的间隔
+	memoryLimitCheckInterval = 10 * time.Second
+)
+
+// runInformerEviction 定期停止空闲或超出内存限制的 informer ，直到 ctx 结束
+func (h *CacheProxyHandler) runInformerEviction(ctx context.Context) {
+	interval := memoryLimitCheckInterval
+	if h.informerIdleTTL > 0 && (h.maxMemory <= 0 || h.informerIdleTTL/2 < interval) {
+		interval = h.informerIdleTTL / 2
+	}
+	if interval < minInformerEvictionInterval {
+		interval = minInformerEvictionInterval
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		h.watchCachesLock.Lock()
+		defer h.watchCachesLock.Unlock()
+		if h.informerIdleTTL > 0 {
+			h.evictIdleInformersLocked(ctx, h.informerIdleTTL)
+		}
+		if h.maxMemory > 0 {
+			h.enforceMemoryLimitLocked(ctx, h.maxMemory)
+		}
+	}, interval)
+}
+
+// evictIdleInformersLocked 停止并移除超过 idleTTL 未被使用的 informer 和 watchCache ，需要持有 watchCachesLock 的写锁
+//
+// 仍有 watch 进行中的不会被移除。被移除的资源再次被请求时会重新建立 informer
+func (h *CacheProxyHandler) evictIdleInformersLocked(ctx context.Context, idleTTL time.Duration) {
+	logger := logr.FromContextOrDiscard(ctx)
+	for key, wc := range h.watchCaches {
+		if wc.IdleTime() < idleTTL || wc.Watching() {
+			continue
+		}
+		logger.V(1).Info(fmt.Sprintf("evict informer for %s idle for %s", key, wc.IdleTime().Truncate(time.Second)))
+		h.removeInformerLocked(ctx, key, wc)
+	}
+}
+
+// enforceMemoryLimitLocked 所有 watchCache 估算的内存占用之和超过 maxMemory 时，
+// 按最近最少使用的顺序停止并移除 informer 和 watchCache ，直到不超过 maxMemory ，需要持有 watchCachesLock 的写锁
+//
+// 仍有 watch 进行中的不会被移除，因此可能无法满足内存限制。被移除的资源在冷却时间内直连
+func (h *CacheProxyHandler) enforceMemoryLimitLocked(ctx context.Context, maxMemory int64) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var total int64
+	keys := make([]watchCacheKey, 0, len(h.watchCaches))
+	for key, wc := range h.watchCaches {
+		total += wc.Memory()
+		keys = append(keys, key)
+	}
+	if total <= maxMemory {
+		return
+	}
+
+	// 最近最少使用的在前
+	sort.Slice(keys, func(i, j int) bool {
+		return h.watchCaches[keys[i]].IdleTime() > h.watchCaches[keys[j]].IdleTime()
+	})
+	limit := resource.NewQuantity(maxMemory, resource.BinarySI)
+	for _, key := range keys {
+		if total <= maxMemory {
+			break
+		}
+		wc := h.watchCaches[key]
+		if wc.Watching() {
+			continue
+		}
+		memory := wc.Memory()
+		err := fmt.Errorf(
+			"cache memory %s exceeds limit %s",
+			resource.NewQuantity(total, resource.BinarySI), limit,
+		)
+		logger.Info(fmt.Sprintf(
+			"evict informer for %s using %s and fall back to passthrough for %s: %v",
+			key, resource.NewQuantity(memory, resource.BinarySI), passthroughCoolDown, err,
+		))
+		h.removeInformerLocked(ctx, key, wc)
+		_ = h.fallbacks.Add(key, passthroughCoolDown, err)
+		total -= memory
+	}
+	if total > maxMemory {
+		logger.V(1).Info(fmt.Sprintf(
+			"cache memory %s still exceeds limit %s, informers with active watches can not be evicted",
+			resource.NewQuantity(total, resource.BinarySI), limit,
+		))
+	}
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+// TestEvictIdleInformers 测试停止空闲的 informer
+func TestEvictIdleInformers(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	fakeCache := &informertest.FakeInformers{Scheme: scheme}
+	h := &CacheProxyHandler{scheme: scheme, cache: fakeCache}
+
+	ctx := context.Background()
+	h.watchCaches = make(map[watchCacheKey]*watchCache)
+	for resource, kind := range map[string]string{"pods": "Pod", "configmaps": "ConfigMap", "services": "Service"} {
+		gvr := corev1.SchemeGroupVersion.WithResource(resource)
+		gvk := corev1.SchemeGroupVersion.WithKind(kind)
+		obj, err := h.newInformerObject(gvk, false)
+		if err != nil {
+			t.Fatalf("new informer object for %s error: %v", gvk, err)
+		}
+		if _, err := fakeCache.GetInformer(ctx, obj); err != nil {
+			t.Fatalf("get informer for %s error: %v", gvk, err)
+		}
+		h.watchCaches[watchCacheKey{gvr: gvr}] = newWatchCache(gvk, nil, 10)
+	}
+
+	idleSince := time.Now().Add(-time.Hour).UnixNano()
+	h.watchCaches[watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource("pods")}].lastAccess.Store(idleSince)
+	services := h.watchCaches[watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource("services")}]
+	services.lastAccess.Store(idleSince)
+	watcher, err := services.Watch(ctx, "", metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("watch services error: %v", err)
+	}
+
+	h.evictIdleInformersLocked(ctx, 10*time.Minute)
+
+	// 空闲的 pods 被停止，最近使用过的 configmaps 和有 watch 进行中的 services 保留
+	if _, ok := h.watchCaches[watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource("pods")}]; ok {
+		t.Errorf("expected watch cache for pods evicted")
+	}
+	if _, ok := fakeCache.InformersByGVK[corev1.SchemeGroupVersion.WithKind("Pod")]; ok {
+		t.Errorf("expected informer for pods removed")
+	}
+	for _, resource := range []string{"configmaps", "services"} {
+		if _, ok := h.watchCaches[watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource(resource)}]; !ok {
+			t.Errorf("expected watch cache for %s kept", resource)
+		}
+	}
+
+	// watch 结束后 services 也被停止
+	watcher.Stop()
+	h.evictIdleInformersLocked(ctx, 10*time.Minute)
+	if _, ok := h.watchCaches[watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource("services")}]; ok {
+		t.Errorf("expected watch cache for services evicted")
+	}
+}
+
+// TestEnforceMemoryLimit 测试超过内存限制时停止最近最少使用的 informer
+func TestEnforceMemoryLimit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	h := &CacheProxyHandler{scheme: scheme, cache: &informertest.FakeInformers{Scheme: scheme}}
+
+	ctx := context.Background()
+	h.watchCaches = make(map[watchCacheKey]*watchCache)
+	idle := map[string]time.Duration{"pods": time.Hour, "configmaps": time.Minute, "services": time.Second}
+	for resource, kind := range map[string]string{"pods": "Pod", "configmaps": "ConfigMap", "services": "Service"} {
+		wc := newWatchCache(corev1.SchemeGroupVersion.WithKind(kind), nil, 10)
+		wc.memory = 100
+		wc.lastAccess.Store(time.Now().Add(-idle[resource]).UnixNano())
+		h.watchCaches[watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource(resource)}] = wc
+	}
+
+	h.enforceMemoryLimitLocked(ctx, 150)
+
+	// 最近最少使用的 pods 和 configmaps 被停止并暂时直连
+	for resource, expected := range map[string]bool{"pods": false, "configmaps": false, "services": true} {
+		key := watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource(resource)}
+		if _, ok := h.watchCaches[key]; ok != expected {
+			t.Errorf("%s: expected kept %t, got: %t", resource, expected, ok)
+		}
+		if err := h.fallbacks.Check(key); (err == nil) != expected {
+			t.Errorf("%s: unexpected passthrough error: %v", resource, err)
+		}
+	}
+}
+
+// TestEnforceMemoryLimitWithWatch 测试超过内存限制时不停止有 watch 进行中的 informer
+func TestEnforceMemoryLimitWithWatch(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	h := &CacheProxyHandler{scheme: scheme, cache: &informertest.FakeInformers{Scheme: scheme}, maxMemory: 150}
+
+	ctx := context.Background()
+	h.watchCaches = make(map[watchCacheKey]*watchCache)
+	idle := map[string]time.Duration{"pods": time.Hour, "configmaps": time.Minute}
+	for resource, kind := range map[string]string{"pods": "Pod", "configmaps": "ConfigMap"} {
+		wc := newWatchCache(corev1.SchemeGroupVersion.WithKind(kind), nil, 10)
+		wc.memory = 100
+		wc.lastAccess.Store(time.Now().Add(-idle[resource]).UnixNano())
+		h.watchCaches[watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource(resource)}] = wc
+	}
+	podsKey := watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource("pods")}
+	watcher, err := h.watchCaches[podsKey].Watch(ctx, "", metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("watch pods error: %v", err)
+	}
+	defer watcher.Stop()
+
+	h.enforceMemoryLimitLocked(ctx, h.maxMemory)
+
+	// 最近最少使用的 pods 有 watch 进行中，保留，停止 configmaps
+	if _, ok := h.watchCaches[podsKey]; !ok {
+		t.Errorf("expected watch cache for pods kept")
+	}
+	if err := h.fallbacks.Check(podsKey); err != nil {
+		t.Errorf("expected no passthrough for pods, got: %v", err)
+	}
+	if _, ok := h.watchCaches[watchCacheKey{gvr: corev1.SchemeGroupVersion.WithResource("configmaps")}]; ok {
+		t.Errorf("expected watch cache for configmaps evicted")
+	}
+
+	// 仍超过内存限制
+	h.watchCaches[podsKey].memory = 200
+	status := h.Status()
+	if !status.MemoryLimitExceeded || status.Message == "" {
+		t.Errorf("expected memory limit exceeded in status, got: %t, %q", status.MemoryLimitExceeded, status.Message)
+	}
+}
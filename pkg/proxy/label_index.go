@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	// labelIndexName 标签键值对的倒排索引名，索引值为 "<key>=<value>"
+	labelIndexName = "label"
+	// labelKeyIndexName 标签键的倒排索引名，索引值为标签键
+	labelKeyIndexName = "labelKey"
+)
+
+// labelIndexers 返回标签倒排索引
+func labelIndexers() toolscache.Indexers {
+	return toolscache.Indexers{
+		labelIndexName:    labelIndexFunc,
+		labelKeyIndexName: labelKeyIndexFunc,
+	}
+}
+
+// labelIndexFunc 获取对象标签键值对的索引值
+func labelIndexFunc(obj interface{}) ([]string, error) {
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	objLabels := objMeta.GetLabels()
+	ret := make([]string, 0, len(objLabels))
+	for k, v := range objLabels {
+		ret = append(ret, labelIndexValue(k, v))
+	}
+	return ret, nil
+}
+
+// labelKeyIndexFunc 获取对象标签键的索引值
+func labelKeyIndexFunc(obj interface{}) ([]string, error) {
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	objLabels := objMeta.GetLabels()
+	ret := make([]string, 0, len(objLabels))
+	for k := range objLabels {
+		ret = append(ret, k)
+	}
+	return ret, nil
+}
+
+// labelIndexValue 返回标签键值对的索引值，标签键中不能包含 "=" ，因此不会产生歧义
+func labelIndexValue(key, value string) string {
+	return key + "=" + value
+}
+
+// selectKeysByIndexes 基于字段索引和标签倒排索引计算可能匹配选择器的对象键，需要持有锁
+//
+// 字段选择器中的相等条件，以及标签选择器中的 = 、 == 、 in 和 exists 条件通过索引取交集；
+// 标签选择器中的 != 、 notin 和 !（不存在）条件从结果中减去索引命中的对象。
+// 没有可用索引的条件时返回 false ，结果仍需用完整的选择器逐个过滤
+func (wc *watchCache) selectKeysByIndexes(
+	namespace string,
+	labelSelector labels.Selector,
+	fieldSelector fields.Selector,
+) (sets.Set[string], bool, error) {
+	var ret sets.Set[string]
+	narrowed := false
+	intersect := func(keys sets.Set[string]) {
+		if !narrowed {
+			ret = keys
+			narrowed = true
+			return
+		}
+		ret = intersectSets(ret, keys)
+	}
+
+	// 字段相等条件
+	for _, req := range fieldSelector.Requirements() {
+		if !isEqualityOperator(req.Operator) {
+			continue
+		}
+		keys, err := wc.store.IndexKeys(fieldIndexName(req.Field), namespacedIndexKey(namespace, req.Value))
+		if err != nil {
+			return nil, false, err
+		}
+		intersect(sets.New(keys...))
+	}
+
+	// 标签条件
+	requirements, selectable := labelSelector.Requirements()
+	if !selectable {
+		// 不匹配任何对象
+		return sets.New[string](), true, nil
+	}
+	var excludes []sets.Set[string]
+	for _, req := range requirements {
+		switch req.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			keys, err := wc.labelValuesKeys(req.Key(), req.Values().UnsortedList())
+			if err != nil {
+				return nil, false, err
+			}
+			intersect(keys)
+		case selection.Exists:
+			keys, err := wc.store.IndexKeys(labelKeyIndexName, req.Key())
+			if err != nil {
+				return nil, false, err
+			}
+			intersect(sets.New(keys...))
+		case selection.NotEquals, selection.NotIn:
+			keys, err := wc.labelValuesKeys(req.Key(), req.Values().UnsortedList())
+			if err != nil {
+				return nil, false, err
+			}
+			excludes = append(excludes, keys)
+		case selection.DoesNotExist:
+			keys, err := wc.store.IndexKeys(labelKeyIndexName, req.Key())
+			if err != nil {
+				return nil, false, err
+			}
+			excludes = append(excludes, sets.New(keys...))
+		}
+	}
+	if len(excludes) > 0 && !narrowed {
+		// 只有否定条件，从所有对象中排除
+		var keys []string
+		if namespace != "" {
+			var err error
+			if keys, err = wc.store.IndexKeys(toolscache.NamespaceIndex, namespace); err != nil {
+				return nil, false, err
+			}
+		} else {
+			keys = wc.store.ListKeys()
+		}
+		intersect(sets.New(keys...))
+	}
+	if !narrowed {
+		return nil, false, nil
+	}
+	for _, keys := range excludes {
+		for key := range keys {
+			ret.Delete(key)
+		}
+	}
+
+	// 标签索引不区分命名空间
+	if namespace != "" {
+		prefix := namespace + "/"
+		for key := range ret {
+			if !strings.HasPrefix(key, prefix) {
+				ret.Delete(key)
+			}
+		}
+	}
+
+	return ret, true, nil
+}
+
+// labelValuesKeys 获取标签 key 的值为 values 之一的对象键
+func (wc *watchCache) labelValuesKeys(key string, values []string) (sets.Set[string], error) {
+	ret := sets.New[string]()
+	for _, value := range values {
+		keys, err := wc.store.IndexKeys(labelIndexName, labelIndexValue(key, value))
+		if err != nil {
+			return nil, err
+		}
+		ret.Insert(keys...)
+	}
+	return ret, nil
+}
+
+// intersectSets 计算两个集合的交集，遍历较小的集合
+func intersectSets(a, b sets.Set[string]) sets.Set[string] {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	ret := sets.New[string]()
+	for key := range a {
+		if b.Has(key) {
+			ret.Insert(key)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+const (
+	// listStreamBufferSize 流式编码列表时的写缓冲大小
+	listStreamBufferSize = 32 * 1024
+	// tableChunkSize 流式编码表格时每次转换的对象数
+	tableChunkSize = 500
+)
+
+// errTableConversion 转换为表格失败
+var errTableConversion = errors.New("convert to table error")
+
+// serveListStream 处理 JSON 格式的列表请求，将缓存中匹配的对象逐个编码写到响应
+//
+// 与 Handle 不同，不拷贝缓存中的对象，也不在内存中构造完整的响应。开始写响应前的错误与 Handle 一样处理，
+// 开始写响应后的错误只能记录日志并中断响应
+func (h *CacheProxyHandler) serveListStream(w http.ResponseWriter, req *http.Request, creq *cacheRequest) {
+	ctx := req.Context()
+	logger := logr.FromContextOrDiscard(ctx)
+
+	opts, err := ParseListOptions(req)
+	if err != nil {
+		h.writeError(w, req, fmt.Errorf("parse list options error: %w", err))
+		return
+	}
+	if opts.ResourceVersion == "" && opts.Continue == "" {
+		if err := h.waitForLatest(ctx, req, creq.wc, creq.gvr, creq.info.Namespace); err != nil {
+			h.writeError(w, req, err)
+			return
+		}
+	}
+	ret, err := h.listFromCache(ctx, creq.wc, creq.info.Namespace, opts)
+	if err != nil {
+		h.writeError(w, req, err)
+		return
+	}
+
+	listMeta := metav1.ListMeta{
+		ResourceVersion:    formatResourceVersion(ret.ResourceVersion),
+		Continue:           ret.Continue,
+		RemainingItemCount: ret.RemainingItemCount,
+	}
+	w, closeWriter := h.newResponseWriter(w, req)
+	lw := newListStreamWriter(w, creq.serializer.Serializer)
+	w.Header().Set("Content-Type", creq.serializer.MediaType)
+
+	listGVK := h.newRequestObject(creq, true).GetObjectKind().GroupVersionKind()
+	switch creq.target.Kind {
+	case kindTable:
+		newList := func() runtime.Object { return h.newRequestObject(creq, true) }
+		err = lw.WriteTable(ctx, creq.tableConvertor, creq.tableOptions, newList, creq.target, listMeta, ret.Items)
+		if errors.Is(err, errTableConversion) {
+			// 与 transformResponseObject 一致，转换为表格失败时返回原列表
+			logger.V(1).Info(err.Error())
+			err = lw.WriteList(listGVK, listMeta, ret.Items, nil)
+		}
+	case kindPartialObjectMetadataList:
+		err = lw.WriteList(creq.target, listMeta, ret.Items, func(obj runtime.Object) (runtime.Object, error) {
+			return asPartialObjectMetadata(obj, creq.target.GroupVersion())
+		})
+	default:
+		err = lw.WriteList(listGVK, listMeta, ret.Items, nil)
+	}
+	if err == nil {
+		err = lw.Flush()
+	}
+	if err == nil {
+		err = closeWriter()
+	}
+	if err != nil {
+		logger.Error(err, "write list response error")
+	}
+}
+
+// listStreamWriter 将列表或表格以 JSON 格式逐项写出
+type listStreamWriter struct {
+	w       http.ResponseWriter
+	buf     *bufio.Writer
+	encoder runtime.Encoder
+	started bool
+}
+
+// newListStreamWriter 创建 listStreamWriter ， encoder 用于编码列表中的对象，需要输出 JSON
+func newListStreamWriter(w http.ResponseWriter, encoder runtime.Encoder) *listStreamWriter {
+	return &listStreamWriter{
+		w:       w,
+		buf:     bufio.NewWriterSize(w, listStreamBufferSize),
+		encoder: encoder,
+	}
+}
+
+// WriteList 写出列表， convert 不为空时写出前先转换每个对象
+//
+// 列表中的对象与缓存共享，不能修改， convert 需要修改对象时应先拷贝
+func (lw *listStreamWriter) WriteList(
+	gvk schema.GroupVersionKind,
+	listMeta metav1.ListMeta,
+	items []runtime.Object,
+	convert func(obj runtime.Object) (runtime.Object, error),
+) error {
+	if err := lw.writeHeader(&streamListHeader{
+		TypeMeta: metav1.TypeMeta{Kind: gvk.Kind, APIVersion: gvk.GroupVersion().String()},
+		ListMeta: listMeta,
+	}, "items"); err != nil {
+		return err
+	}
+	for i, item := range items {
+		if convert != nil {
+			var err error
+			if item, err = convert(item); err != nil {
+				return fmt.Errorf("convert item %d error: %w", i, err)
+			}
+		}
+		if i > 0 {
+			if _, err := lw.buf.WriteString(","); err != nil {
+				return err
+			}
+		}
+		if err := lw.encoder.Encode(item, lw.buf); err != nil {
+			return fmt.Errorf("encode item %d error: %w", i, err)
+		}
+	}
+	_, err := lw.buf.WriteString("]}\n")
+	return err
+}
+
+// WriteTable 分批将对象转换为表格行并写出
+//
+// 每批对象浅拷贝到 newList 创建的列表中转换，表头取自第一批的转换结果。
+// 第一批转换失败时不写出任何内容，返回 errTableConversion
+func (lw *listStreamWriter) WriteTable(
+	ctx context.Context,
+	tableConvertor registryrest.TableConvertor,
+	tableOptions *metav1.TableOptions,
+	newList func() runtime.Object,
+	target schema.GroupVersionKind,
+	listMeta metav1.ListMeta,
+	items []runtime.Object,
+) error {
+	convertChunk := func(chunk []runtime.Object, opts *metav1.TableOptions) (*metav1.Table, error) {
+		list := newList()
+		if err := meta.SetList(list, chunk); err != nil {
+			return nil, fmt.Errorf("set items to %T error: %w", list, err)
+		}
+		table, err := ConvertToTable(ctx, tableConvertor, list, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errTableConversion, err)
+		}
+		return table, nil
+	}
+
+	table, err := convertChunk(items[:min(len(items), tableChunkSize)], tableOptions)
+	if err != nil {
+		return err
+	}
+	// 之后的批次不需要表头
+	restOptions := &metav1.TableOptions{}
+	if tableOptions != nil {
+		*restOptions = *tableOptions
+	}
+	restOptions.NoHeaders = true
+	if err := lw.writeHeader(&streamTableHeader{
+		TypeMeta:          metav1.TypeMeta{Kind: target.Kind, APIVersion: target.GroupVersion().String()},
+		ListMeta:          listMeta,
+		ColumnDefinitions: table.ColumnDefinitions,
+	}, "rows"); err != nil {
+		return err
+	}
+	first := true
+	for start := 0; ; {
+		for i := range table.Rows {
+			if !first {
+				if _, err := lw.buf.WriteString(","); err != nil {
+					return err
+				}
+			}
+			first = false
+			raw, err := json.Marshal(&table.Rows[i])
+			if err != nil {
+				return fmt.Errorf("encode table row error: %w", err)
+			}
+			if _, err := lw.buf.Write(raw); err != nil {
+				return err
+			}
+		}
+
+		start += tableChunkSize
+		if start >= len(items) {
+			break
+		}
+		if table, err = convertChunk(items[start:min(len(items), start+tableChunkSize)], restOptions); err != nil {
+			return err
+		}
+	}
+	_, err = lw.buf.WriteString("]}\n")
+	return err
+}
+
+// Flush 将缓冲的内容写到响应
+func (lw *listStreamWriter) Flush() error {
+	if err := lw.buf.Flush(); err != nil {
+		return err
+	}
+	if flusher, ok := lw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// writeHeader 写响应头和列表除列表项外的部分，直到列表项字段 field 的开头
+func (lw *listStreamWriter) writeHeader(header interface{}, field string) error {
+	raw, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("encode list header error: %w", err)
+	}
+	if !lw.started {
+		lw.w.WriteHeader(http.StatusOK)
+		lw.started = true
+	}
+	// 去掉末尾的 "}" 后接着写列表项
+	if _, err := lw.buf.Write(raw[:len(raw)-1]); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(lw.buf, ",%q:[", field)
+	return err
+}
+
+// streamListHeader 流式编码的列表除列表项外的部分
+type streamListHeader struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+}
+
+// streamTableHeader 流式编码的表格除行外的部分
+type streamTableHeader struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ListMeta   `json:"metadata"`
+	ColumnDefinitions []metav1.TableColumnDefinition `json:"columnDefinitions"`
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// TestListStreamWriter 测试流式编码列表和表格
+func TestListStreamWriter(t *testing.T) {
+	info, ok := runtime.SerializerInfoForMediaType(
+		serializer.NewCodecFactory(runtime.NewScheme()).SupportedMediaTypes(),
+		runtime.ContentTypeJSON,
+	)
+	if !ok {
+		t.Fatalf("no serializer for %s", runtime.ContentTypeJSON)
+	}
+	items := make([]runtime.Object, tableChunkSize+10)
+	for i := range items {
+		items[i] = newTestPod("default", fmt.Sprintf("pod-%04d", i), "10")
+	}
+	listMeta := metav1.ListMeta{ResourceVersion: "10", Continue: "next"}
+
+	// 列表
+	rec := httptest.NewRecorder()
+	lw := newListStreamWriter(rec, info.Serializer)
+	if err := lw.WriteList(corev1.SchemeGroupVersion.WithKind("PodList"), listMeta, items, nil); err != nil {
+		t.Fatalf("write list error: %v", err)
+	}
+	if err := lw.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	list := &corev1.PodList{}
+	if err := json.Unmarshal(rec.Body.Bytes(), list); err != nil {
+		t.Fatalf("decode list error: %v, body: %s", err, rec.Body.String())
+	}
+	if list.Kind != "PodList" || list.APIVersion != "v1" || list.ResourceVersion != "10" || list.Continue != "next" {
+		t.Errorf("unexpected list meta: %#v, %#v", list.TypeMeta, list.ListMeta)
+	}
+	if len(list.Items) != len(items) || list.Items[len(items)-1].Name != fmt.Sprintf("pod-%04d", len(items)-1) {
+		t.Errorf("unexpected items count: %d", len(list.Items))
+	}
+
+	// 表格，超过一批
+	rec = httptest.NewRecorder()
+	lw = newListStreamWriter(rec, info.Serializer)
+	newList := func() runtime.Object { return &corev1.PodList{} }
+	if err := lw.WriteTable(
+		context.Background(),
+		registryrest.NewDefaultTableConvertor(corev1.Resource("pods")),
+		nil,
+		newList,
+		metav1.SchemeGroupVersion.WithKind(kindTable),
+		listMeta,
+		items,
+	); err != nil {
+		t.Fatalf("write table error: %v", err)
+	}
+	if err := lw.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status code %d, got: %d", http.StatusOK, rec.Code)
+	}
+	table := &metav1.Table{}
+	if err := json.Unmarshal(rec.Body.Bytes(), table); err != nil {
+		t.Fatalf("decode table error: %v, body: %s", err, rec.Body.String())
+	}
+	if table.Kind != kindTable || table.ResourceVersion != "10" || len(table.ColumnDefinitions) == 0 {
+		t.Errorf("unexpected table header: %#v, %#v, %v", table.TypeMeta, table.ListMeta, table.ColumnDefinitions)
+	}
+	if len(table.Rows) != len(items) || table.Rows[len(items)-1].Cells[0] != fmt.Sprintf("pod-%04d", len(items)-1) {
+		t.Errorf("unexpected rows count: %d", len(table.Rows))
+	}
+
+	// 空表格仍有表头
+	rec = httptest.NewRecorder()
+	lw = newListStreamWriter(rec, info.Serializer)
+	if err := lw.WriteTable(
+		context.Background(),
+		registryrest.NewDefaultTableConvertor(corev1.Resource("pods")),
+		nil,
+		newList,
+		metav1.SchemeGroupVersion.WithKind(kindTable),
+		listMeta,
+		nil,
+	); err != nil {
+		t.Fatalf("write table error: %v", err)
+	}
+	_ = lw.Flush()
+	table = &metav1.Table{}
+	if err := json.Unmarshal(rec.Body.Bytes(), table); err != nil {
+		t.Fatalf("decode table error: %v, body: %s", err, rec.Body.String())
+	}
+	if len(table.ColumnDefinitions) == 0 || len(table.Rows) != 0 {
+		t.Errorf("unexpected empty table: %#v", table)
+	}
+}
+
+// TestListStreamItemKind 测试流式编码的 JSON 列表与非流式编码的 YAML 列表中列表项的 apiVersion 和 kind 一致
+func TestListStreamItemKind(t *testing.T) {
+	mediaTypes := serializer.NewCodecFactory(runtime.NewScheme()).SupportedMediaTypes()
+	jsonInfo, _ := runtime.SerializerInfoForMediaType(mediaTypes, runtime.ContentTypeJSON)
+	yamlInfo, _ := runtime.SerializerInfoForMediaType(mediaTypes, runtime.ContentTypeYAML)
+	podGVK := corev1.SchemeGroupVersion.WithKind("Pod")
+	// 对象进入缓存时设置 gvk
+	wc := newWatchCache(podGVK, nil, 10)
+	handler := wc.EventHandler()
+	handler.OnAdd(newTestPod("default", "a", "10"), true)
+	handler.OnAdd(newTestPod("default", "b", "11"), true)
+	var items []runtime.Object
+	for _, item := range wc.store.List() {
+		items = append(items, item.(runtime.Object))
+	}
+
+	// JSON ，流式编码，不拷贝缓存中的对象
+	rec := httptest.NewRecorder()
+	lw := newListStreamWriter(rec, jsonInfo.Serializer)
+	if err := lw.WriteList(corev1.SchemeGroupVersion.WithKind("PodList"), metav1.ListMeta{}, items, nil); err != nil {
+		t.Fatalf("write list error: %v", err)
+	}
+	if err := lw.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+
+	// YAML ，与 HandleList 一样拷贝对象后编码
+	list := &corev1.PodList{}
+	list.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PodList"))
+	for _, item := range items {
+		list.Items = append(list.Items, *item.DeepCopyObject().(*corev1.Pod))
+	}
+	yamlRaw, err := runtime.Encode(yamlInfo.Serializer, list)
+	if err != nil {
+		t.Fatalf("encode yaml error: %v", err)
+	}
+
+	for _, c := range []struct {
+		name string
+		raw  []byte
+	}{
+		{name: "json", raw: rec.Body.Bytes()},
+		{name: "yaml", raw: yamlRaw},
+	} {
+		ret := &unstructured.UnstructuredList{}
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal(c.raw, &obj); err != nil {
+			t.Fatalf("decode %s list error: %v", c.name, err)
+		}
+		ret.SetUnstructuredContent(obj)
+		if len(ret.Items) != len(items) {
+			t.Fatalf("expected %d items in %s list, got: %d", len(items), c.name, len(ret.Items))
+		}
+		for _, item := range ret.Items {
+			if item.GetAPIVersion() != "v1" || item.GetKind() != "Pod" {
+				t.Errorf("expected item of v1 Pod in %s list, got: %s %s", c.name, item.GetAPIVersion(), item.GetKind())
+			}
+		}
+	}
+}
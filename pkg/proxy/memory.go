@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// objectMemoryFactor 对象在内存中的大小与其 protobuf 序列化大小之比的估计值
+	//
+	// 解码后的对象包含指针、字符串头、切片头和 map 等额外开销，通常是序列化大小的数倍
+	objectMemoryFactor = 3
+	// unstructuredValueOverhead 无结构对象内容中每个值的固定开销的估计值（接口值、字符串头或切片头等）
+	unstructuredValueOverhead = 16
+)
+
+// estimateObjectSize 估算对象占用的内存（字节）
+//
+// 内置类型和 PartialObjectMetadata 按 protobuf 序列化大小估算，无结构对象按其内容估算，其它对象返回 0
+func estimateObjectSize(obj runtime.Object) int64 {
+	switch o := obj.(type) {
+	case interface{ Size() int }:
+		return int64(o.Size()) * objectMemoryFactor
+	case runtime.Unstructured:
+		return estimateUnstructuredSize(o.UnstructuredContent())
+	}
+	return 0
+}
+
+// estimateUnstructuredSize 估算无结构对象内容占用的内存（字节）
+func estimateUnstructuredSize(value interface{}) int64 {
+	size := int64(unstructuredValueOverhead)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			size += unstructuredValueOverhead + int64(len(k)) + estimateUnstructuredSize(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			size += estimateUnstructuredSize(item)
+		}
+	case string:
+		size += int64(len(v))
+	}
+	return size
+}
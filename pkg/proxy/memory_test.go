@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestEstimateObjectSize 测试估算对象占用的内存
+func TestEstimateObjectSize(t *testing.T) {
+	pod := newTestPod("default", "a", "1")
+	if size := estimateObjectSize(pod); size != int64(pod.Size())*objectMemoryFactor {
+		t.Errorf("expected %d, got: %d", int64(pod.Size())*objectMemoryFactor, size)
+	}
+
+	small := &unstructured.Unstructured{}
+	small.SetName("a")
+	large := small.DeepCopy()
+	large.SetAnnotations(map[string]string{"note": string(make([]byte, 1024))})
+	if estimateObjectSize(large)-estimateObjectSize(small) < 1024 {
+		t.Errorf("expected size of large object to be at least 1024 bytes larger, got: %d, %d",
+			estimateObjectSize(large), estimateObjectSize(small))
+	}
+}
+
+// TestWatchCacheMemory 测试 watchCache 估算的内存占用随对象变化
+func TestWatchCacheMemory(t *testing.T) {
+	wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), nil, 10)
+	handler := wc.EventHandler()
+
+	a := newTestPod("default", "a", "10")
+	b := newTestPod("default", "b", "11")
+	handler.OnAdd(a, true)
+	handler.OnAdd(b, true)
+	if expected := estimateObjectSize(a) + estimateObjectSize(b); wc.Memory() != expected {
+		t.Errorf("expected %d, got: %d", expected, wc.Memory())
+	}
+
+	newA := newTestPod("default", "a", "12")
+	newA.Labels = map[string]string{"app": "test"}
+	handler.OnUpdate(a, newA)
+	if expected := estimateObjectSize(newA) + estimateObjectSize(b); wc.Memory() != expected {
+		t.Errorf("expected %d, got: %d", expected, wc.Memory())
+	}
+
+	handler.OnDelete(newTestPod("default", "b", "13"))
+	if expected := estimateObjectSize(newA); wc.Memory() != expected {
+		t.Errorf("expected %d, got: %d", expected, wc.Memory())
+	}
+}
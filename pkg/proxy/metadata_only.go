@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// newMetadataOnlyResources 将仅缓存元数据的资源规范化为复数形式的资源名
+func newMetadataOnlyResources(mapper meta.RESTMapper, resources []schema.GroupResource) sets.Set[schema.GroupResource] {
+	ret := sets.New[schema.GroupResource]()
+	for _, gr := range resources {
+		if gvr, err := mapper.ResourceFor(gr.WithVersion("")); err == nil {
+			gr = gvr.GroupResource()
+		}
+		ret.Insert(gr)
+	}
+	return ret
+}
+
+// newPartialObjectMetadata 创建指定类型的空 PartialObjectMetadata 或 PartialObjectMetadataList 对象
+func newPartialObjectMetadata(gvk schema.GroupVersionKind, isList bool) runtime.Object {
+	var obj runtime.Object = &metav1.PartialObjectMetadata{}
+	if isList {
+		gvk.Kind += "List"
+		obj = &metav1.PartialObjectMetadataList{}
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return obj
+}
+
+// servableFromMetadata 判断协商得到的响应类型能否仅由缓存的元数据生成
+//
+// 只有表格和 PartialObjectMetadata 格式不需要完整对象，请求完整对象（包括表格中包含完整对象）时应交给 APIServer 处理
+func servableFromMetadata(target schema.GroupVersionKind, tableOptions *metav1.TableOptions) bool {
+	switch target.Kind {
+	case kindTable:
+		return tableOptions == nil || tableOptions.IncludeObject != metav1.IncludeObject
+	case kindPartialObjectMetadata, kindPartialObjectMetadataList:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+// TestServableFromMetadata 测试仅缓存元数据时根据 Accept 请求头判断能否由缓存响应
+func TestServableFromMetadata(t *testing.T) {
+	cases := []struct {
+		accept        string
+		isList        bool
+		includeObject metav1.IncludeObjectPolicy
+		servable      bool
+	}{
+		{
+			// kubectl get
+			accept:   "application/json;as=Table;v=v1;g=meta.k8s.io,application/json;as=Table;v=v1beta1;g=meta.k8s.io,application/json",
+			isList:   true,
+			servable: true,
+		},
+		{
+			// client-go metadata 客户端
+			accept:   "application/vnd.kubernetes.protobuf;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1, application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1, application/json",
+			isList:   true,
+			servable: true,
+		},
+		{accept: "application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1", servable: true},
+		{accept: "application/json;as=Table;g=meta.k8s.io;v=v1beta1", servable: true},
+		{
+			accept:        "application/json;as=Table;g=meta.k8s.io;v=v1",
+			includeObject: metav1.IncludeMetadata,
+			servable:      true,
+		},
+		// 表格中包含完整对象
+		{accept: "application/json;as=Table;g=meta.k8s.io;v=v1", includeObject: metav1.IncludeObject},
+		// 请求完整对象
+		{accept: "application/json", isList: true},
+		{accept: "application/json"},
+		{accept: "*/*"},
+		{accept: ""},
+		{accept: "application/json;as=Foo;g=meta.k8s.io;v=v1, application/json", isList: true},
+	}
+	serializers := serializer.NewCodecFactory(runtime.NewScheme()).SupportedMediaTypes()
+	for i, c := range cases {
+		req := &http.Request{Header: http.Header{"Accept": []string{c.accept}}}
+		_, target, err := negotiateResponse(req, serializers, c.isList, true)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		var tableOptions *metav1.TableOptions
+		if c.includeObject != "" {
+			tableOptions = &metav1.TableOptions{IncludeObject: c.includeObject}
+		}
+		if servable := servableFromMetadata(target, tableOptions); servable != c.servable {
+			t.Errorf("case %d: expected servableFromMetadata %t, got: %t", i, c.servable, servable)
+		}
+	}
+}
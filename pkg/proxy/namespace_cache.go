@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// watchCacheKey watchCache 的键
+//
+// 经代理转发的写入同样按命名空间记录，读取命名空间级的缓存时只等待该命名空间中的写入
+type watchCacheKey struct {
+	gvr schema.GroupVersionResource
+	// informer 所在的命名空间，为空表示所有命名空间
+	namespace string
+}
+
+// String 返回字符串形式
+func (key watchCacheKey) String() string {
+	if key.namespace == "" {
+		return key.gvr.String()
+	}
+	return fmt.Sprintf("%s in namespace %q", key.gvr, key.namespace)
+}
+
+// isNamespaced 判断类型是否是命名空间级的
+func (h *CacheProxyHandler) isNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	mapping, err := h.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, fmt.Errorf("get rest mapping for %s error: %w", gvk, err)
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// cacheForNamespaceLocked 获取仅缓存指定命名空间的 cache.Cache ，命名空间为空时返回缓存所有命名空间的 cache.Cache ，
+// 需要持有 watchCachesLock 的写锁
+func (h *CacheProxyHandler) cacheForNamespaceLocked(namespace string) (cache.Cache, error) {
+	if namespace == "" {
+		return h.cache, nil
+	}
+	if c, ok := h.namespaceCaches[namespace]; ok {
+		return c, nil
+	}
+	if h.newNamespaceCache == nil {
+		return nil, fmt.Errorf("namespace-scoped cache is not supported")
+	}
+	c, err := h.newNamespaceCache(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("create cache for namespace %q error: %w", namespace, err)
+	}
+	if h.namespaceCaches == nil {
+		h.namespaceCaches = make(map[string]cache.Cache)
+	}
+	h.namespaceCaches[namespace] = c
+	return c, nil
+}
@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+const (
+	// kindTable 表格类型
+	kindTable = "Table"
+	// kindPartialObjectMetadata 仅包含元数据的对象类型
+	kindPartialObjectMetadata = "PartialObjectMetadata"
+	// kindPartialObjectMetadataList 仅包含元数据的对象列表类型
+	kindPartialObjectMetadataList = "PartialObjectMetadataList"
+)
+
+// negotiateResponse 根据 Accept 请求头协商响应的媒体类型和响应对象的类型
+//
+// 与 APIServer 一致，支持通过 as 、 g 、 v 参数请求 meta.k8s.io 的 v1 或 v1beta1 版本的 Table 、
+// PartialObjectMetadata 和 PartialObjectMetadataList 类型。按 Accept 中的顺序选择第一个可以满足的媒体类型，
+// 不要求转换时返回空的 GroupVersionKind 。 allowProtobuf 为 false 时（比如无结构对象）不使用 protobuf 编码原始对象，
+// Table 只能以 JSON 或 YAML 编码。没有可以满足的媒体类型，或请求的类型与对象不匹配（比如列表请求
+// PartialObjectMetadata ）时返回 406 错误
+func negotiateResponse(
+	req *http.Request,
+	serializers []runtime.SerializerInfo,
+	isList bool,
+	allowProtobuf bool,
+) (runtime.SerializerInfo, schema.GroupVersionKind, error) {
+	accept := req.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		accept = runtime.ContentTypeJSON
+	}
+	for _, clause := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(clause))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "*/*", "application/*":
+			mediaType = runtime.ContentTypeJSON
+		}
+		info, ok := runtime.SerializerInfoForMediaType(serializers, mediaType)
+		if !ok {
+			continue
+		}
+
+		as := params["as"]
+		if as == "" {
+			// 不要求转换
+			if info.MediaType == runtime.ContentTypeProtobuf && !allowProtobuf {
+				continue
+			}
+			return info, schema.GroupVersionKind{}, nil
+		}
+		if params["g"] != metav1.GroupName {
+			continue
+		}
+		switch params["v"] {
+		case metav1.SchemeGroupVersion.Version, "v1beta1":
+		default:
+			continue
+		}
+		target := schema.GroupVersionKind{Group: params["g"], Version: params["v"], Kind: as}
+		switch as {
+		case kindTable:
+			if info.MediaType == runtime.ContentTypeProtobuf {
+				continue
+			}
+		case kindPartialObjectMetadata:
+			if isList {
+				return info, target, newNotAcceptableError(fmt.Sprintf(
+					"you requested %s, but the requested object is a list", kindPartialObjectMetadata,
+				))
+			}
+		case kindPartialObjectMetadataList:
+			if !isList {
+				return info, target, newNotAcceptableError(fmt.Sprintf(
+					"you requested %s, but the requested object is not a list", kindPartialObjectMetadataList,
+				))
+			}
+		default:
+			continue
+		}
+		return info, target, nil
+	}
+
+	supported := make([]string, 0, len(serializers))
+	for _, info := range serializers {
+		supported = append(supported, info.MediaType)
+	}
+	return runtime.SerializerInfo{}, schema.GroupVersionKind{}, newNotAcceptableError(fmt.Sprintf(
+		"only the following media types are accepted: %s, or with as=%s, as=%s or as=%s and g=%s, v=v1 or v1beta1",
+		strings.Join(supported, ", "),
+		kindTable, kindPartialObjectMetadata, kindPartialObjectMetadataList, metav1.GroupName,
+	))
+}
+
+// streamingSerializers 返回支持流式编码（用于 watch ）的序列化器
+func streamingSerializers(serializers []runtime.SerializerInfo) []runtime.SerializerInfo {
+	ret := make([]runtime.SerializerInfo, 0, len(serializers))
+	for _, info := range serializers {
+		if info.StreamSerializer != nil {
+			ret = append(ret, info)
+		}
+	}
+	return ret
+}
+
+// encodeResponse 以指定序列化器编码响应对象，不支持以该序列化器编码时（比如无结构对象不支持 protobuf ）使用 JSON 编码
+//
+// 返回编码结果和对应的 Content-Type
+func encodeResponse(
+	serializers []runtime.SerializerInfo,
+	info runtime.SerializerInfo,
+	obj runtime.Object,
+) ([]byte, string, error) {
+	buf := &bytes.Buffer{}
+	if info.Serializer != nil {
+		if err := info.Serializer.Encode(obj, buf); err == nil {
+			return buf.Bytes(), info.MediaType, nil
+		}
+		buf.Reset()
+	}
+	jsonInfo, ok := runtime.SerializerInfoForMediaType(serializers, runtime.ContentTypeJSON)
+	if !ok {
+		return nil, "", fmt.Errorf("no serializer for %s", runtime.ContentTypeJSON)
+	}
+	if err := jsonInfo.Serializer.Encode(obj, buf); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), jsonInfo.MediaType, nil
+}
+
+// newNotAcceptableError 创建 406 错误
+func newNotAcceptableError(message string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusNotAcceptable,
+		Reason:  metav1.StatusReasonNotAcceptable,
+		Message: message,
+	}}
+}
+
+// transformResponseObject 将对象转换为协商得到的响应类型，类型为空时返回原对象
+//
+// 转换为表格失败时返回原对象
+func transformResponseObject(
+	ctx context.Context,
+	tableConvertor registryrest.TableConvertor,
+	tableOptions *metav1.TableOptions,
+	obj runtime.Object,
+	target schema.GroupVersionKind,
+) (runtime.Object, error) {
+	switch target.Kind {
+	case kindTable:
+		if tableConvertor == nil {
+			return obj, nil
+		}
+		table, err := ConvertToTable(ctx, tableConvertor, obj, tableOptions)
+		if err != nil {
+			logr.FromContextOrDiscard(ctx).V(1).Info(fmt.Sprintf("convert to table error: %v", err))
+			return obj, nil
+		}
+		table.SetGroupVersionKind(target)
+		return table, nil
+	case kindPartialObjectMetadata, kindPartialObjectMetadataList:
+		return asPartialObjectMetadata(obj, target.GroupVersion())
+	}
+	return obj, nil
+}
+
+// asPartialObjectMetadata 将对象或列表转换为指定版本的 PartialObjectMetadata 或 PartialObjectMetadataList
+func asPartialObjectMetadata(obj runtime.Object, gv schema.GroupVersion) (runtime.Object, error) {
+	if !meta.IsListType(obj) {
+		objMeta, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		partial := meta.AsPartialObjectMetadata(objMeta)
+		partial.SetGroupVersionKind(gv.WithKind(kindPartialObjectMetadata))
+		return partial, nil
+	}
+
+	listMeta, err := meta.ListAccessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	list := &metav1.PartialObjectMetadataList{
+		ListMeta: metav1.ListMeta{
+			SelfLink:           listMeta.GetSelfLink(),
+			ResourceVersion:    listMeta.GetResourceVersion(),
+			Continue:           listMeta.GetContinue(),
+			RemainingItemCount: listMeta.GetRemainingItemCount(),
+		},
+		Items: make([]metav1.PartialObjectMetadata, 0, meta.LenList(obj)),
+	}
+	list.SetGroupVersionKind(gv.WithKind(kindPartialObjectMetadataList))
+	if err := meta.EachListItem(obj, func(item runtime.Object) error {
+		objMeta, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		partial := meta.AsPartialObjectMetadata(objMeta)
+		partial.SetGroupVersionKind(gv.WithKind(kindPartialObjectMetadata))
+		list.Items = append(list.Items, *partial)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+// TestNegotiateResponse 测试根据 Accept 请求头协商响应的媒体类型和对象类型
+func TestNegotiateResponse(t *testing.T) {
+	serializers := serializer.NewCodecFactory(runtime.NewScheme()).SupportedMediaTypes()
+	cases := []struct {
+		accept        string
+		isList        bool
+		unstructured  bool
+		mediaType     string
+		expected      schema.GroupVersionKind
+		notAcceptable bool
+	}{
+		{
+			// kubectl get
+			accept:    "application/json;as=Table;v=v1;g=meta.k8s.io,application/json;as=Table;v=v1beta1;g=meta.k8s.io,application/json",
+			isList:    true,
+			mediaType: "application/json",
+			expected:  schema.GroupVersionKind{Group: "meta.k8s.io", Version: "v1", Kind: "Table"},
+		},
+		{
+			// client-go metadata 客户端
+			accept:    "application/vnd.kubernetes.protobuf;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1, application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1, application/json",
+			isList:    true,
+			mediaType: "application/vnd.kubernetes.protobuf",
+			expected:  schema.GroupVersionKind{Group: "meta.k8s.io", Version: "v1", Kind: "PartialObjectMetadataList"},
+		},
+		{
+			accept:    "application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1beta1",
+			mediaType: "application/json",
+			expected:  schema.GroupVersionKind{Group: "meta.k8s.io", Version: "v1beta1", Kind: "PartialObjectMetadata"},
+		},
+		{accept: "application/json", mediaType: "application/json"},
+		{accept: "application/yaml", mediaType: "application/yaml"},
+		{accept: "*/*", mediaType: "application/json"},
+		{accept: "", mediaType: "application/json"},
+		{accept: "application/vnd.kubernetes.protobuf, application/json", mediaType: "application/vnd.kubernetes.protobuf"},
+		// 无结构对象不使用 protobuf 编码
+		{accept: "application/vnd.kubernetes.protobuf, application/json", unstructured: true, mediaType: "application/json"},
+		{accept: "application/vnd.kubernetes.protobuf", unstructured: true, notAcceptable: true},
+		// 表格不使用 protobuf 编码
+		{
+			accept:    "application/vnd.kubernetes.protobuf;as=Table;g=meta.k8s.io;v=v1, application/json",
+			mediaType: "application/json",
+		},
+		// 不支持的 as 参数时使用下一个媒体类型
+		{accept: "application/json;as=Foo;g=meta.k8s.io;v=v1, application/json", mediaType: "application/json"},
+		{accept: "application/json;as=Table;g=meta.k8s.io;v=v2", notAcceptable: true},
+		{accept: "application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1", isList: true, notAcceptable: true},
+		{accept: "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1", notAcceptable: true},
+		{accept: "text/html", notAcceptable: true},
+	}
+	for i, c := range cases {
+		req := &http.Request{Header: http.Header{"Accept": []string{c.accept}}}
+		info, target, err := negotiateResponse(req, serializers, c.isList, !c.unstructured)
+		if c.notAcceptable {
+			if !apierrors.IsNotAcceptable(err) {
+				t.Errorf("case %d: expected not acceptable error, got: %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if info.MediaType != c.mediaType || target != c.expected {
+			t.Errorf("case %d: expected (%s, %v), got: (%s, %v)", i, c.mediaType, c.expected, info.MediaType, target)
+		}
+	}
+}
+
+// TestEncodeResponse 测试编码响应对象
+func TestEncodeResponse(t *testing.T) {
+	serializers := serializer.NewCodecFactory(runtime.NewScheme()).SupportedMediaTypes()
+	protobufInfo, _ := runtime.SerializerInfoForMediaType(serializers, runtime.ContentTypeProtobuf)
+
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+	}
+	raw, contentType, err := encodeResponse(serializers, protobufInfo, pod)
+	if err != nil {
+		t.Fatalf("encode pod error: %v", err)
+	}
+	if contentType != runtime.ContentTypeProtobuf || !bytes.HasPrefix(raw, []byte("k8s\x00")) {
+		t.Errorf("unexpected encoded pod: %s, %q", contentType, raw)
+	}
+
+	// 无结构对象不支持 protobuf ，使用 JSON
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("Foo")
+	obj.SetName("test")
+	raw, contentType, err = encodeResponse(serializers, protobufInfo, obj)
+	if err != nil {
+		t.Fatalf("encode unstructured error: %v", err)
+	}
+	if contentType != runtime.ContentTypeJSON || !bytes.HasPrefix(raw, []byte("{")) {
+		t.Errorf("unexpected encoded unstructured: %s, %q", contentType, raw)
+	}
+}
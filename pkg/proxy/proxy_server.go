@@ -28,6 +28,8 @@ type ServerOptions struct {
 
 	// Kubernetes API 代理
 	APIProxy APIProxyServerOptions
+	// 缓存
+	Cache CacheOptions
 	// 静态文件服务
 	Static StaticServerOptions
 
@@ -81,6 +83,7 @@ func NewServer(ctx context.Context, opts ServerOptions) (*Server, error) {
 		opts.RESTMapper,
 		opts.APIProxy.Keepalive,
 		opts.APIProxy.AppendLocationPath,
+		opts.Cache,
 		s.Notify,
 	)
 	if err != nil {
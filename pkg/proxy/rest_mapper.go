@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// rediscoverMinInterval 找不到资源时重新发现 API 的最小间隔，避免请求不存在的资源时频繁请求 APIServer
+const rediscoverMinInterval = 10 * time.Second
+
+// NewDynamicRESTMapper 基于 delegate 创建 DynamicRESTMapper
+//
+// apiWatcher 不为空时， CRD 或 APIService 变化后重置 delegate
+func NewDynamicRESTMapper(delegate meta.RESTMapper, apiWatcher *APIWatcher) *DynamicRESTMapper {
+	m := &DynamicRESTMapper{
+		delegate:    delegate,
+		minInterval: rediscoverMinInterval,
+	}
+	if apiWatcher != nil {
+		apiWatcher.AddHandler(func(event APIChangeEvent) {
+			m.Reset()
+		})
+	}
+	return m
+}
+
+// DynamicRESTMapper 在 APIServer 提供的 API 变化后能感知新资源的 meta.RESTMapper
+//
+// 找不到资源时重置 delegate （ delegate 实现 meta.ResettableRESTMapper 时）并重新发现后重试
+type DynamicRESTMapper struct {
+	delegate    meta.RESTMapper
+	minInterval time.Duration
+
+	lock sync.Mutex
+	// 上次因找不到资源而重新发现的时间
+	lastRediscover time.Time
+}
+
+var _ meta.ResettableRESTMapper = &DynamicRESTMapper{}
+
+// KindFor 返回资源对应的 Kind
+func (m *DynamicRESTMapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	return retryOnNoMatch(m, func() (schema.GroupVersionKind, error) {
+		return m.delegate.KindFor(resource)
+	})
+}
+
+// KindsFor 返回资源对应的所有 Kind
+func (m *DynamicRESTMapper) KindsFor(resource schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+	return retryOnNoMatch(m, func() ([]schema.GroupVersionKind, error) {
+		return m.delegate.KindsFor(resource)
+	})
+}
+
+// ResourceFor 返回部分指定的资源对应的完整资源
+func (m *DynamicRESTMapper) ResourceFor(input schema.GroupVersionResource) (schema.GroupVersionResource, error) {
+	return retryOnNoMatch(m, func() (schema.GroupVersionResource, error) {
+		return m.delegate.ResourceFor(input)
+	})
+}
+
+// ResourcesFor 返回部分指定的资源对应的所有完整资源
+func (m *DynamicRESTMapper) ResourcesFor(input schema.GroupVersionResource) ([]schema.GroupVersionResource, error) {
+	return retryOnNoMatch(m, func() ([]schema.GroupVersionResource, error) {
+		return m.delegate.ResourcesFor(input)
+	})
+}
+
+// RESTMapping 返回 Kind 对应的 RESTMapping
+func (m *DynamicRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	return retryOnNoMatch(m, func() (*meta.RESTMapping, error) {
+		return m.delegate.RESTMapping(gk, versions...)
+	})
+}
+
+// RESTMappings 返回 Kind 对应的所有 RESTMapping
+func (m *DynamicRESTMapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*meta.RESTMapping, error) {
+	return retryOnNoMatch(m, func() ([]*meta.RESTMapping, error) {
+		return m.delegate.RESTMappings(gk, versions...)
+	})
+}
+
+// ResourceSingularizer 返回资源名的单数形式
+func (m *DynamicRESTMapper) ResourceSingularizer(resource string) (string, error) {
+	return retryOnNoMatch(m, func() (string, error) {
+		return m.delegate.ResourceSingularizer(resource)
+	})
+}
+
+// Reset 重置 delegate ，下次使用时重新发现 API
+func (m *DynamicRESTMapper) Reset() {
+	if resettable, ok := m.delegate.(meta.ResettableRESTMapper); ok {
+		resettable.Reset()
+	}
+}
+
+// rediscover 重置 delegate 以重新发现 API ，距上次重新发现不足 minInterval 时不重置并返回 false
+func (m *DynamicRESTMapper) rediscover() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.lastRediscover.IsZero() && time.Since(m.lastRediscover) < m.minInterval {
+		return false
+	}
+	m.lastRediscover = time.Now()
+	m.Reset()
+	return true
+}
+
+// retryOnNoMatch 执行 f ，找不到资源时重新发现 API 后重试一次
+func retryOnNoMatch[T any](m *DynamicRESTMapper, f func() (T, error)) (T, error) {
+	ret, err := f()
+	if err != nil && meta.IsNoMatchError(err) && m.rediscover() {
+		return f()
+	}
+	return ret, err
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resettableRESTMapper 测试用的 meta.ResettableRESTMapper ，重置时载入 kinds 中的所有类型
+type resettableRESTMapper struct {
+	*meta.DefaultRESTMapper
+	kinds  []schema.GroupVersionKind
+	resets int
+}
+
+// Reset 重置
+func (m *resettableRESTMapper) Reset() {
+	m.resets++
+	m.DefaultRESTMapper = meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range m.kinds {
+		m.Add(gvk, meta.RESTScopeNamespace)
+	}
+}
+
+// TestDynamicRESTMapper 测试找不到资源时重新发现
+func TestDynamicRESTMapper(t *testing.T) {
+	delegate := &resettableRESTMapper{DefaultRESTMapper: meta.NewDefaultRESTMapper(nil)}
+	m := NewDynamicRESTMapper(delegate, nil)
+
+	fooGVR := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "foos"}
+	fooGVK := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Foo"}
+	barGVR := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "bars"}
+
+	// 启动后安装的资源
+	delegate.kinds = append(delegate.kinds, fooGVK)
+	gvk, err := m.KindFor(fooGVR)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gvk != fooGVK {
+		t.Errorf("expected %s, got: %s", fooGVK, gvk)
+	}
+	if delegate.resets != 1 {
+		t.Errorf("expected 1 reset, got: %d", delegate.resets)
+	}
+
+	// 不存在的资源不会频繁重新发现
+	if _, err := m.KindFor(barGVR); !meta.IsNoMatchError(err) {
+		t.Errorf("expected no match error, got: %v", err)
+	}
+	if delegate.resets != 1 {
+		t.Errorf("expected 1 reset, got: %d", delegate.resets)
+	}
+
+	// 超过最小间隔后再次重新发现
+	m.minInterval = 0
+	time.Sleep(time.Millisecond)
+	if _, err := m.KindFor(barGVR); !meta.IsNoMatchError(err) {
+		t.Errorf("expected no match error, got: %v", err)
+	}
+	if delegate.resets != 2 {
+		t.Errorf("expected 2 resets, got: %d", delegate.resets)
+	}
+}
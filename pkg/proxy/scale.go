@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kubernetes/pkg/apis/apps"
+	"k8s.io/kubernetes/pkg/apis/autoscaling"
+	"k8s.io/kubernetes/pkg/apis/core"
+)
+
+// scaleSubresource scale 子资源名
+const scaleSubresource = "scale"
+
+// scaleFromObject 从缓存的对象计算 autoscaling/v1 版本的 scale 子资源
+//
+// 内置资源转换为 __internal 版本后计算，定制资源按 CRD 中声明的 scale 子资源计算。
+// 资源没有 scale 子资源时返回 404 错误，CRD 未能及时同步时返回 errPassthrough
+func (h *CacheProxyHandler) scaleFromObject(
+	ctx context.Context,
+	gvr schema.GroupVersionResource,
+	obj runtime.Object,
+) (runtime.Object, error) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+
+	if !h.scheme.Recognizes(gvk) {
+		// 定制资源
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a *unstructured.Unstructured", obj)
+		}
+		if err := h.waitForCRDSynced(ctx); err != nil {
+			return nil, err
+		}
+		version, err := FindCRDVersion(h.crdLister, gvk)
+		if err != nil || version.Subresources == nil || version.Subresources.Scale == nil {
+			return nil, newSubresourceNotFoundError(gvr, scaleSubresource)
+		}
+		return ScaleFromCustomResource(u, version.Subresources.Scale)
+	}
+
+	// 内置资源
+	internalObj, err := h.scheme.New(gvk.GroupKind().WithVersion(runtime.APIVersionInternal))
+	if err != nil {
+		return nil, newSubresourceNotFoundError(gvr, scaleSubresource)
+	}
+	if err := h.scheme.Convert(obj, internalObj, nil); err != nil {
+		return nil, fmt.Errorf("convert %T to internal version error: %w", obj, err)
+	}
+	scale, ok, err := ScaleFromObject(internalObj)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, newSubresourceNotFoundError(gvr, scaleSubresource)
+	}
+	return h.scheme.ConvertToVersion(scale, autoscalingv1.SchemeGroupVersion)
+}
+
+// ScaleFromObject 从 __internal 版本内置对象计算 scale 子资源，没有 scale 子资源的类型返回 false
+//
+// 与 APIServer 中各资源 registry 的 scaleFromXxx 逻辑一致，
+// 由于 k8s.io/kubernetes/pkg/registry 依赖的模块无法引入，这里按 Kubernetes v1.30 的实现同步维护
+func ScaleFromObject(obj runtime.Object) (*autoscaling.Scale, bool, error) {
+	switch typedObj := obj.(type) {
+	case *apps.Deployment:
+		scale, err := newScale(&typedObj.ObjectMeta, typedObj.Spec.Replicas, typedObj.Status.Replicas, typedObj.Spec.Selector)
+		return scale, true, err
+	case *apps.ReplicaSet:
+		scale, err := newScale(&typedObj.ObjectMeta, typedObj.Spec.Replicas, typedObj.Status.Replicas, typedObj.Spec.Selector)
+		return scale, true, err
+	case *apps.StatefulSet:
+		scale, err := newScale(&typedObj.ObjectMeta, typedObj.Spec.Replicas, typedObj.Status.Replicas, typedObj.Spec.Selector)
+		return scale, true, err
+	case *core.ReplicationController:
+		return &autoscaling.Scale{
+			ObjectMeta: scaleObjectMeta(&typedObj.ObjectMeta),
+			Spec:       autoscaling.ScaleSpec{Replicas: typedObj.Spec.Replicas},
+			Status: autoscaling.ScaleStatus{
+				Replicas: typedObj.Status.Replicas,
+				Selector: labels.SelectorFromSet(typedObj.Spec.Selector).String(),
+			},
+		}, true, nil
+	}
+	return nil, false, nil
+}
+
+// newScale 基于对象元数据、期望和当前副本数以及标签选择器创建 Scale
+func newScale(
+	objMeta *metav1.ObjectMeta,
+	specReplicas, statusReplicas int32,
+	labelSelector *metav1.LabelSelector,
+) (*autoscaling.Scale, error) {
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector: %w", err)
+	}
+	return &autoscaling.Scale{
+		ObjectMeta: scaleObjectMeta(objMeta),
+		Spec:       autoscaling.ScaleSpec{Replicas: specReplicas},
+		Status:     autoscaling.ScaleStatus{Replicas: statusReplicas, Selector: selector.String()},
+	}, nil
+}
+
+// scaleObjectMeta 返回 Scale 的元数据，只保留名字、命名空间、 UID 、资源版本和创建时间
+func scaleObjectMeta(objMeta *metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              objMeta.Name,
+		Namespace:         objMeta.Namespace,
+		UID:               objMeta.UID,
+		ResourceVersion:   objMeta.ResourceVersion,
+		CreationTimestamp: objMeta.CreationTimestamp,
+	}
+}
+
+// ScaleFromCustomResource 按 CRD 中声明的 scale 子资源从定制资源计算 autoscaling/v1 版本的 Scale
+//
+// 与 APIServer 一致，副本数字段不存在时为 0 ，没有声明 labelSelectorPath 时标签选择器为空
+func ScaleFromCustomResource(
+	obj *unstructured.Unstructured,
+	scaleSpec *apiextensionsv1.CustomResourceSubresourceScale,
+) (*autoscalingv1.Scale, error) {
+	content := obj.UnstructuredContent()
+	specReplicas, _, err := unstructured.NestedInt64(content, scaleFieldPath(scaleSpec.SpecReplicasPath)...)
+	if err != nil {
+		return nil, fmt.Errorf("get %s error: %w", scaleSpec.SpecReplicasPath, err)
+	}
+	statusReplicas, _, err := unstructured.NestedInt64(content, scaleFieldPath(scaleSpec.StatusReplicasPath)...)
+	if err != nil {
+		return nil, fmt.Errorf("get %s error: %w", scaleSpec.StatusReplicasPath, err)
+	}
+	var selector string
+	if scaleSpec.LabelSelectorPath != nil && *scaleSpec.LabelSelectorPath != "" {
+		selector, _, err = unstructured.NestedString(content, scaleFieldPath(*scaleSpec.LabelSelectorPath)...)
+		if err != nil {
+			return nil, fmt.Errorf("get %s error: %w", *scaleSpec.LabelSelectorPath, err)
+		}
+	}
+
+	return &autoscalingv1.Scale{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: autoscalingv1.SchemeGroupVersion.String(),
+			Kind:       "Scale",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              obj.GetName(),
+			Namespace:         obj.GetNamespace(),
+			UID:               obj.GetUID(),
+			ResourceVersion:   obj.GetResourceVersion(),
+			CreationTimestamp: obj.GetCreationTimestamp(),
+		},
+		Spec:   autoscalingv1.ScaleSpec{Replicas: int32(specReplicas)},
+		Status: autoscalingv1.ScaleStatus{Replicas: int32(statusReplicas), Selector: selector},
+	}, nil
+}
+
+// scaleFieldPath 将 CRD scale 子资源中 .spec.replicas 形式的路径拆分为字段列表
+func scaleFieldPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "."), ".")
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TestScaleFromObject 测试从内置资源计算 scale 子资源
+func TestScaleFromObject(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	h := &CacheProxyHandler{scheme: scheme}
+
+	replicas := int32(3)
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", ResourceVersion: "10", Labels: map[string]string{"a": "b"}},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 2},
+	}
+	deploy.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	ret, err := h.scaleFromObject(context.Background(), appsv1.SchemeGroupVersion.WithResource("deployments"), deploy)
+	if err != nil {
+		t.Fatalf("get scale error: %v", err)
+	}
+	scale, ok := ret.(*autoscalingv1.Scale)
+	if !ok {
+		t.Fatalf("expected *autoscalingv1.Scale, got: %T", ret)
+	}
+	if scale.APIVersion != "autoscaling/v1" || scale.Kind != "Scale" || scale.Name != "foo" || scale.ResourceVersion != "10" ||
+		len(scale.Labels) != 0 || scale.Spec.Replicas != 3 || scale.Status.Replicas != 2 || scale.Status.Selector != "app=foo" {
+		t.Errorf("unexpected scale: %#v", scale)
+	}
+
+	// 没有 scale 子资源的类型
+	pod := newTestPod("default", "foo", "10")
+	pod.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+	_, err = h.scaleFromObject(context.Background(), corev1.SchemeGroupVersion.WithResource("pods"), pod)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+// TestScaleFromObjectCRDNotSynced 测试 CRD 一直不同步时计算定制资源的 scale 子资源在超时后直连
+func TestScaleFromObjectCRDNotSynced(t *testing.T) {
+	defer func(timeout time.Duration) { informerSyncTimeout = timeout }(informerSyncTimeout)
+	informerSyncTimeout = 200 * time.Millisecond
+
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	h := &CacheProxyHandler{
+		scheme:    scheme,
+		crdSynced: func() bool { return false },
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Foo",
+		"metadata":   map[string]interface{}{"namespace": "default", "name": "foo", "resourceVersion": "10"},
+	}}
+	_, err := h.scaleFromObject(context.Background(), schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "foos"}, obj)
+	if !errors.Is(err, errPassthrough) {
+		t.Errorf("expected passthrough error, got: %v", err)
+	}
+}
+
+// TestScaleFromCustomResource 测试按 CRD 声明从定制资源计算 scale 子资源
+func TestScaleFromCustomResource(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Foo",
+		"metadata":   map[string]interface{}{"namespace": "default", "name": "foo", "resourceVersion": "10"},
+		"spec":       map[string]interface{}{"size": int64(5)},
+		"status":     map[string]interface{}{"selector": "app=foo"},
+	}}
+	labelSelectorPath := ".status.selector"
+	scale, err := ScaleFromCustomResource(obj, &apiextensionsv1.CustomResourceSubresourceScale{
+		SpecReplicasPath:   ".spec.size",
+		StatusReplicasPath: ".status.replicas",
+		LabelSelectorPath:  &labelSelectorPath,
+	})
+	if err != nil {
+		t.Fatalf("get scale error: %v", err)
+	}
+	if scale.Name != "foo" || scale.ResourceVersion != "10" || scale.Spec.Replicas != 5 ||
+		scale.Status.Replicas != 0 || scale.Status.Selector != "app=foo" {
+		t.Errorf("unexpected scale: %#v", scale)
+	}
+}
@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kubernetes/pkg/apis/apps"
+	"k8s.io/kubernetes/pkg/apis/batch"
+	"k8s.io/kubernetes/pkg/apis/certificates"
+	"k8s.io/kubernetes/pkg/apis/core"
+	"k8s.io/kubernetes/pkg/apis/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SelectableFields 获取 __internal 版本内置对象可用于字段选择器的字段，不支持的类型返回 false
+//
+// 与 APIServer 中各资源 registry strategy 的 ToSelectableFields （ GetAttrs ）逻辑一致，
+// 由于 k8s.io/kubernetes/pkg/registry 依赖的模块无法引入，这里按 Kubernetes v1.30.2 的实现同步维护，
+// 来源为 k8s.io/kubernetes/pkg/registry/<组>/<资源>/strategy.go ，升级 k8s.io/kubernetes 时需要对照更新
+func SelectableFields(obj runtime.Object) (fields.Set, bool) {
+	switch typedObj := obj.(type) {
+	case *core.Pod:
+		podSpecificFieldsSet := make(fields.Set, 10)
+		podSpecificFieldsSet["spec.nodeName"] = typedObj.Spec.NodeName
+		podSpecificFieldsSet["spec.restartPolicy"] = string(typedObj.Spec.RestartPolicy)
+		podSpecificFieldsSet["spec.schedulerName"] = typedObj.Spec.SchedulerName
+		podSpecificFieldsSet["spec.serviceAccountName"] = typedObj.Spec.ServiceAccountName
+		if typedObj.Spec.SecurityContext != nil {
+			podSpecificFieldsSet["spec.hostNetwork"] = strconv.FormatBool(typedObj.Spec.SecurityContext.HostNetwork)
+		} else {
+			podSpecificFieldsSet["spec.hostNetwork"] = strconv.FormatBool(false)
+		}
+		podSpecificFieldsSet["status.phase"] = string(typedObj.Status.Phase)
+		podIP := ""
+		if len(typedObj.Status.PodIPs) > 0 {
+			podIP = typedObj.Status.PodIPs[0].IP
+		}
+		podSpecificFieldsSet["status.podIP"] = podIP
+		podSpecificFieldsSet["status.nominatedNodeName"] = typedObj.Status.NominatedNodeName
+		return addObjectMetaFieldsSet(podSpecificFieldsSet, &typedObj.ObjectMeta, true), true
+	case *core.Node:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, false), fields.Set{
+			"spec.unschedulable": fmt.Sprint(typedObj.Spec.Unschedulable),
+		}), true
+	case *core.Secret:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, true), fields.Set{
+			"type": string(typedObj.Type),
+		}), true
+	case *core.Namespace:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, false), fields.Set{
+			"status.phase": string(typedObj.Status.Phase),
+			// APIServer 为了兼容支持该字段
+			"name": typedObj.Name,
+		}), true
+	case *core.Event:
+		// core/v1 和 events.k8s.io 的 Event 对应同一 __internal 类型
+		source := typedObj.Source.Component
+		if source == "" {
+			source = typedObj.ReportingController
+		}
+		return mergeFieldsSets(fields.Set{
+			"involvedObject.kind":            typedObj.InvolvedObject.Kind,
+			"involvedObject.namespace":       typedObj.InvolvedObject.Namespace,
+			"involvedObject.name":            typedObj.InvolvedObject.Name,
+			"involvedObject.uid":             string(typedObj.InvolvedObject.UID),
+			"involvedObject.apiVersion":      typedObj.InvolvedObject.APIVersion,
+			"involvedObject.resourceVersion": typedObj.InvolvedObject.ResourceVersion,
+			"involvedObject.fieldPath":       typedObj.InvolvedObject.FieldPath,
+			"reason":                         typedObj.Reason,
+			"reportingComponent":             typedObj.ReportingController,
+			"source":                         source,
+			"type":                           typedObj.Type,
+		}, objectMetaFieldsSet(&typedObj.ObjectMeta, true)), true
+	case *core.ReplicationController:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, true), fields.Set{
+			"status.replicas": strconv.Itoa(int(typedObj.Status.Replicas)),
+		}), true
+	case *core.PersistentVolume:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, false), fields.Set{
+			// APIServer 为了兼容支持该字段
+			"name": typedObj.Name,
+		}), true
+	case *core.PersistentVolumeClaim:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, true), fields.Set{
+			// APIServer 为了兼容支持该字段
+			"name": typedObj.Name,
+		}), true
+	case *apps.ReplicaSet:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, true), fields.Set{
+			"status.replicas": strconv.Itoa(int(typedObj.Status.Replicas)),
+		}), true
+	case *batch.Job:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, true), fields.Set{
+			"status.successful": strconv.Itoa(int(typedObj.Status.Succeeded)),
+		}), true
+	case *certificates.CertificateSigningRequest:
+		return mergeFieldsSets(objectMetaFieldsSet(&typedObj.ObjectMeta, false), fields.Set{
+			"spec.signerName": typedObj.Spec.SignerName,
+		}), true
+	case *resource.ResourceSlice:
+		sliceFieldsSet := make(fields.Set, 3)
+		sliceFieldsSet["nodeName"] = typedObj.NodeName
+		sliceFieldsSet["driverName"] = typedObj.DriverName
+		return addObjectMetaFieldsSet(sliceFieldsSet, &typedObj.ObjectMeta, false), true
+	}
+	return nil, false
+}
+
+// objectMetaFieldsSet 返回 ObjectMeta 中可用于字段选择器的字段
+//
+// 与 k8s.io/apiserver/pkg/registry/generic 中的同名方法一致，为避免引入其依赖（ etcd 等）在此实现
+func objectMetaFieldsSet(objectMeta *metav1.ObjectMeta, hasNamespaceField bool) fields.Set {
+	return addObjectMetaFieldsSet(make(fields.Set, 2), objectMeta, hasNamespaceField)
+}
+
+// addObjectMetaFieldsSet 将 ObjectMeta 中可用于字段选择器的字段添加到 source 中
+func addObjectMetaFieldsSet(source fields.Set, objectMeta *metav1.ObjectMeta, hasNamespaceField bool) fields.Set {
+	source["metadata.name"] = objectMeta.Name
+	if hasNamespaceField {
+		source["metadata.namespace"] = objectMeta.Namespace
+	}
+	return source
+}
+
+// mergeFieldsSets 将 fragment 中的字段合并到 source 中
+func mergeFieldsSets(source fields.Set, fragment fields.Set) fields.Set {
+	for k, value := range fragment {
+		source[k] = value
+	}
+	return source
+}
+
+// SelectableFieldNames 获取指定内置类型可用于字段选择器的字段名，不支持的类型返回 nil
+func SelectableFieldNames(scheme *runtime.Scheme, gvk schema.GroupVersionKind) []string {
+	internalObj, err := scheme.New(gvk.GroupKind().WithVersion(runtime.APIVersionInternal))
+	if err != nil {
+		return nil
+	}
+	objFields, ok := SelectableFields(internalObj)
+	if !ok {
+		return nil
+	}
+	ret := make([]string, 0, len(objFields))
+	for name := range objFields {
+		ret = append(ret, name)
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// newSelectableFieldsIndexer 为指定类型创建基于 SelectableFields 的字段索引器
+func newSelectableFieldsIndexer(scheme *runtime.Scheme, gvk schema.GroupVersionKind) *selectableFieldsIndexer {
+	return &selectableFieldsIndexer{scheme: scheme, gvk: gvk}
+}
+
+// selectableFieldsIndexer 基于 SelectableFields 的字段索引器
+//
+// 计算字段前需要将对象转换为 __internal 版本，同一对象的各个字段索引依次计算，
+// 因此缓存最近一个对象的字段，避免重复转换
+type selectableFieldsIndexer struct {
+	scheme *runtime.Scheme
+	gvk    schema.GroupVersionKind
+
+	lock       sync.Mutex
+	lastObj    runtime.Object
+	lastFields fields.Set
+}
+
+// Fields 获取对象可用于字段选择器的字段
+func (indexer *selectableFieldsIndexer) Fields(obj runtime.Object) (fields.Set, bool) {
+	indexer.lock.Lock()
+	defer indexer.lock.Unlock()
+
+	if obj == indexer.lastObj {
+		return indexer.lastFields, indexer.lastFields != nil
+	}
+
+	internalObj, err := indexer.scheme.New(indexer.gvk.GroupKind().WithVersion(runtime.APIVersionInternal))
+	if err != nil {
+		return nil, false
+	}
+	if err := indexer.scheme.Convert(obj, internalObj, nil); err != nil {
+		return nil, false
+	}
+	ret, ok := SelectableFields(internalObj)
+	indexer.lastObj = obj
+	indexer.lastFields = ret
+	return ret, ok
+}
+
+// IndexerFunc 返回指定字段的索引方法
+func (indexer *selectableFieldsIndexer) IndexerFunc(field string) client.IndexerFunc {
+	return func(obj client.Object) []string {
+		objFields, ok := indexer.Fields(obj)
+		if !ok {
+			return nil
+		}
+		val, ok := objFields[field]
+		if !ok {
+			return nil
+		}
+		return []string{val}
+	}
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TestSelectableFieldsIndexer 测试内置资源的字段索引
+func TestSelectableFieldsIndexer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+
+	nodeGVK := corev1.SchemeGroupVersion.WithKind("Node")
+	if names := SelectableFieldNames(scheme, nodeGVK); !slices.Equal(names, []string{"metadata.name", "spec.unschedulable"}) {
+		t.Errorf("unexpected selectable fields for Node: %v", names)
+	}
+	indexFunc := newSelectableFieldsIndexer(scheme, nodeGVK).IndexerFunc("spec.unschedulable")
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Spec: corev1.NodeSpec{Unschedulable: true}}
+	if values := indexFunc(node); !slices.Equal(values, []string{"true"}) {
+		t.Errorf("unexpected index values: %v", values)
+	}
+
+	// events.k8s.io 的 Event 与 core/v1 的 Event 支持同样的字段
+	names := SelectableFieldNames(scheme, eventsv1.SchemeGroupVersion.WithKind("Event"))
+	if !slices.Contains(names, "involvedObject.kind") {
+		t.Errorf("unexpected selectable fields for events.k8s.io Event: %v", names)
+	}
+
+	// 其它资源没有额外字段
+	if names := SelectableFieldNames(scheme, corev1.SchemeGroupVersion.WithKind("Service")); names != nil {
+		t.Errorf("unexpected selectable fields for Service: %v", names)
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// statusSubresource status 子资源名
+const statusSubresource = "status"
+
+// hasSubresource 判断资源是否有指定子资源
+//
+// 定制资源按 CRD 中声明的子资源判断，其它资源按 APIServer 的 discovery 信息判断。
+// CRD 未能及时同步或无法获取 discovery 信息时返回 errPassthrough
+func (h *CacheProxyHandler) hasSubresource(
+	ctx context.Context,
+	gvr schema.GroupVersionResource,
+	gvk schema.GroupVersionKind,
+	subresource string,
+) (bool, error) {
+	if !h.scheme.Recognizes(gvk) {
+		// 定制资源
+		if err := h.waitForCRDSynced(ctx); err != nil {
+			return false, err
+		}
+		if version, err := FindCRDVersion(h.crdLister, gvk); err == nil {
+			if version.Subresources == nil {
+				return false, nil
+			}
+			switch subresource {
+			case statusSubresource:
+				return version.Subresources.Status != nil, nil
+			case scaleSubresource:
+				return version.Subresources.Scale != nil, nil
+			}
+			return false, nil
+		}
+	}
+
+	// 内置资源或聚合 API
+	resources, err := h.discovery.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false, fmt.Errorf("%w: discover resources for %s error: %w", errPassthrough, gvr.GroupVersion(), err)
+	}
+	name := gvr.Resource + "/" + subresource
+	for _, res := range resources.APIResources {
+		if res.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newSubresourceNotFoundError 创建资源没有指定子资源时的 404 错误，与 APIServer 一致不包含详情
+func newSubresourceNotFoundError(gvr schema.GroupVersionResource, subresource string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusNotFound,
+		Reason:  metav1.StatusReasonNotFound,
+		Message: fmt.Sprintf("the server could not find the requested resource (%s/%s)", gvr.GroupResource(), subresource),
+	}}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	listersapiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// TestHasSubresource 测试判断资源是否有子资源
+func TestHasSubresource(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+
+	crdIndexer := toolscache.NewIndexer(toolscache.MetaNamespaceKeyFunc, toolscache.Indexers{})
+	_ = crdIndexer.Add(&apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "foos.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "example.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "Foo", ListKind: "FooList"},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1", Subresources: &apiextensionsv1.CustomResourceSubresources{
+					Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+				}},
+				{Name: "v2"},
+			},
+		},
+	})
+
+	h := &CacheProxyHandler{
+		scheme:    scheme,
+		crdLister: listersapiextensionsv1.NewCustomResourceDefinitionLister(crdIndexer),
+		crdSynced: func() bool { return true },
+		discovery: &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{{Name: "pods"}, {Name: "pods/status"}, {Name: "configmaps"}},
+			},
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{{Name: "deployments"}, {Name: "deployments/scale"}},
+			},
+		}}},
+	}
+
+	foo := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	fooV2 := schema.GroupVersion{Group: "example.com", Version: "v2"}
+	cases := []struct {
+		gvr         schema.GroupVersionResource
+		gvk         schema.GroupVersionKind
+		subresource string
+		expected    bool
+	}{
+		{corev1.SchemeGroupVersion.WithResource("pods"), corev1.SchemeGroupVersion.WithKind("Pod"), statusSubresource, true},
+		{corev1.SchemeGroupVersion.WithResource("configmaps"), corev1.SchemeGroupVersion.WithKind("ConfigMap"), statusSubresource, false},
+		{appsv1.SchemeGroupVersion.WithResource("deployments"), appsv1.SchemeGroupVersion.WithKind("Deployment"), scaleSubresource, true},
+		{foo.WithResource("foos"), foo.WithKind("Foo"), statusSubresource, true},
+		{foo.WithResource("foos"), foo.WithKind("Foo"), scaleSubresource, false},
+		{fooV2.WithResource("foos"), fooV2.WithKind("Foo"), statusSubresource, false},
+	}
+	for _, c := range cases {
+		ret, err := h.hasSubresource(context.Background(), c.gvr, c.gvk, c.subresource)
+		if err != nil {
+			t.Errorf("%s/%s: unexpected error: %v", c.gvr, c.subresource, err)
+			continue
+		}
+		if ret != c.expected {
+			t.Errorf("%s/%s: expected %t, got: %t", c.gvr, c.subresource, c.expected, ret)
+		}
+	}
+}
+
+// TestHasSubresourceCRDNotSynced 测试 CRD 一直不同步时判断定制资源的子资源在超时后直连
+func TestHasSubresourceCRDNotSynced(t *testing.T) {
+	defer func(timeout time.Duration) { informerSyncTimeout = timeout }(informerSyncTimeout)
+	informerSyncTimeout = 200 * time.Millisecond
+
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	h := &CacheProxyHandler{
+		scheme:    scheme,
+		crdSynced: func() bool { return false },
+	}
+
+	foo := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	_, err := h.hasSubresource(context.Background(), foo.WithResource("foos"), foo.WithKind("Foo"), statusSubresource)
+	if !errors.Is(err, errPassthrough) {
+		t.Errorf("expected passthrough error, got: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	informersexternalversions "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
 	listersapiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
@@ -16,6 +17,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	registryrest "k8s.io/apiserver/pkg/registry/rest"
 	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
 	"k8s.io/kubernetes/pkg/apis/admissionregistration"
 	"k8s.io/kubernetes/pkg/apis/apiserverinternal"
 	"k8s.io/kubernetes/pkg/apis/apps"
@@ -123,14 +125,53 @@ func (getter *cachedTableConvertorGetter) TableConvertorForObject(
 
 // NewCRDTableConvertorGetterForConfig 基于客户端配置创建一个 CRD TableConvertorGetter
 func NewCRDTableConvertorGetterForConfig(config *rest.Config) (TableConvertorGetter, error) {
-	client, err := apiextensionsclientset.NewForConfig(config)
+	lister, _, err := NewCRDListerForConfig(config)
 	if err != nil {
 		return nil, err
 	}
+	return NewCRDTableConvertorGetter(lister), nil
+}
+
+// NewCRDListerForConfig 基于客户端配置创建并启动一个 CRD Lister ，同时返回判断其是否已同步的方法
+func NewCRDListerForConfig(
+	config *rest.Config,
+) (listersapiextensionsv1.CustomResourceDefinitionLister, toolscache.InformerSynced, error) {
+	client, err := apiextensionsclientset.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
 	factory := informersexternalversions.NewSharedInformerFactoryWithOptions(client, time.Hour)
-	lister := factory.Apiextensions().V1().CustomResourceDefinitions().Lister()
+	informer := factory.Apiextensions().V1().CustomResourceDefinitions()
+	lister := informer.Lister()
+	synced := informer.Informer().HasSynced
 	factory.Start(nil)
-	return NewCRDTableConvertorGetter(lister), nil
+	return lister, synced, nil
+}
+
+// FindCRDVersion 从 CRD Lister 中查找定义指定类型（ Kind 或 ListKind ）的 CRD 版本
+func FindCRDVersion(
+	crdLister listersapiextensionsv1.CustomResourceDefinitionLister,
+	gvk schema.GroupVersionKind,
+) (*apiextensionsv1.CustomResourceDefinitionVersion, error) {
+	crds, err := crdLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, crd := range crds {
+		if crd.Spec.Group != gvk.Group {
+			continue
+		}
+		if crd.Spec.Names.Kind != gvk.Kind && crd.Spec.Names.ListKind != gvk.Kind {
+			continue
+		}
+		for i, version := range crd.Spec.Versions {
+			if version.Name != gvk.Version {
+				continue
+			}
+			return &crd.Spec.Versions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no crd found for %s", gvk.GroupKind().String())
 }
 
 // NewCRDTableConvertorGetter 创建一个 CRD TableConvertorGetter
@@ -153,26 +194,11 @@ var _ TableConvertorGetter = &crdTableConvertorGetter{}
 func (getter *crdTableConvertorGetter) TableConvertorForObject(
 	obj runtime.Object,
 ) (registryrest.TableConvertor, error) {
-	crds, err := getter.crdGetter.List(labels.Everything())
+	version, err := FindCRDVersion(getter.crdGetter, obj.GetObjectKind().GroupVersionKind())
 	if err != nil {
 		return nil, err
 	}
-	gvk := obj.GetObjectKind().GroupVersionKind()
-	for _, crd := range crds {
-		if crd.Spec.Group != gvk.Group {
-			continue
-		}
-		if crd.Spec.Names.Kind != gvk.Kind && crd.Spec.Names.ListKind != gvk.Kind {
-			continue
-		}
-		for _, version := range crd.Spec.Versions {
-			if version.Name != gvk.Version {
-				continue
-			}
-			return customresourcetableconvertor.New(version.AdditionalPrinterColumns)
-		}
-	}
-	return nil, fmt.Errorf("no crd found for %s", gvk.GroupKind().String())
+	return customresourcetableconvertor.New(version.AdditionalPrinterColumns)
 }
 
 // AggregateTableConvertor 聚合的 TableConvertor
@@ -220,7 +246,25 @@ func (tc MultiVersionTableConvertor) ConvertToTable(
 	}
 
 	// 转换为表格
-	return tc.IntervalVersion.ConvertToTable(ctx, internalObj, opts)
+	table, err := tc.IntervalVersion.ConvertToTable(ctx, internalObj, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 需要完整对象时将行中的对象转换回原版本
+	if tableOpts, ok := opts.(*metav1.TableOptions); ok && tableOpts != nil && tableOpts.IncludeObject == metav1.IncludeObject {
+		for i, row := range table.Rows {
+			if row.Object.Object == nil {
+				continue
+			}
+			versioned, err := tc.Scheme.ConvertToVersion(row.Object.Object, gvk.GroupVersion())
+			if err != nil {
+				return nil, fmt.Errorf("convert %T to version %s error: %w", row.Object.Object, gvk.GroupVersion(), err)
+			}
+			table.Rows[i].Object.Object = versioned
+		}
+	}
+	return table, nil
 }
 
 // BuiltinTableConvertorGetter 内置对象 TableConvertor 的 TableConvertorGetter
@@ -259,16 +303,14 @@ func BuiltinTableConvertorGetter(scheme *runtime.Scheme) TableConvertorGetter {
 }
 
 // NewDefaultTableConvertor 创建一个默认的 TableConvertor
-func NewDefaultTableConvertor(config *rest.Config, scheme *runtime.Scheme) (registryrest.TableConvertor, error) {
-	crdConvertorGetter, err := NewCRDTableConvertorGetterForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("create crd table convertor getter error: %w", err)
-	}
-
+func NewDefaultTableConvertor(
+	scheme *runtime.Scheme,
+	crdLister listersapiextensionsv1.CustomResourceDefinitionLister,
+) registryrest.TableConvertor {
 	return AggregateTableConvertor{
 		TableConvertorGetter: TableConvertorGetters{
 			BuiltinTableConvertorGetter(scheme),
-			NewCachedTableConvertorGetter(crdConvertorGetter),
+			NewCachedTableConvertorGetter(NewCRDTableConvertorGetter(crdLister)),
 		},
-	}, nil
+	}
 }
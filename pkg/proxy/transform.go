@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// TransformOptions 缓存对象前对其进行裁剪的选项
+//
+// 裁剪在 informer 接收对象时进行，从缓存返回的对象都不包含被裁剪的部分
+type TransformOptions struct {
+	// 是否去掉 metadata.managedFields
+	StripManagedFields bool
+	// 去掉的注解，比如 kubectl.kubernetes.io/last-applied-configuration
+	StripAnnotations []string
+	// 去掉的字段，格式为 JSONPath ，比如 .status.images 或 .spec.containers[*].env ，仅支持字段名和 [*]
+	StripFields []string
+	// 是否将获取单个完整对象的请求（比如 kubectl get -o yaml ）直连 APIServer ，以便返回未裁剪的对象
+	PassthroughFullObjectGets bool
+}
+
+// IsEmpty 判断是否不需要裁剪对象
+func (opts TransformOptions) IsEmpty() bool {
+	return !opts.StripManagedFields && len(opts.StripAnnotations) == 0 && len(opts.StripFields) == 0
+}
+
+// NewObjectTransform 基于选项创建 informer 接收对象时对其进行裁剪的方法，不需要裁剪时返回 nil
+func NewObjectTransform(opts TransformOptions) (toolscache.TransformFunc, error) {
+	if opts.IsEmpty() {
+		return nil, nil
+	}
+	fieldPaths := make([][]fieldPathSegment, 0, len(opts.StripFields))
+	for _, field := range opts.StripFields {
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return nil, fmt.Errorf("parse field path %q error: %w", field, err)
+		}
+		fieldPaths = append(fieldPaths, path)
+	}
+
+	return func(in interface{}) (interface{}, error) {
+		obj, ok := in.(runtime.Object)
+		if !ok {
+			return in, nil
+		}
+		objMeta, err := meta.Accessor(obj)
+		if err != nil {
+			return in, nil
+		}
+
+		if opts.StripManagedFields && objMeta.GetManagedFields() != nil {
+			objMeta.SetManagedFields(nil)
+		}
+		if annotations := objMeta.GetAnnotations(); len(annotations) > 0 && len(opts.StripAnnotations) > 0 {
+			for _, key := range opts.StripAnnotations {
+				delete(annotations, key)
+			}
+			if len(annotations) == 0 {
+				annotations = nil
+			}
+			objMeta.SetAnnotations(annotations)
+		}
+		if len(fieldPaths) > 0 {
+			return removeFields(obj, fieldPaths)
+		}
+		return obj, nil
+	}, nil
+}
+
+// fieldPathSegment 字段路径中的一段
+type fieldPathSegment struct {
+	// 字段名
+	name string
+	// 字段值是否是数组，后续路径作用于其中每个元素
+	eachItem bool
+}
+
+// parseFieldPath 解析 JSONPath 形式的字段路径，仅支持字段名和 [*]
+func parseFieldPath(jsonPath string) ([]fieldPathSegment, error) {
+	jsonPath = strings.TrimSuffix(strings.TrimPrefix(jsonPath, "{"), "}")
+	jsonPath = strings.TrimPrefix(jsonPath, ".")
+	if jsonPath == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	var path []fieldPathSegment
+	for _, part := range strings.Split(jsonPath, ".") {
+		segment := fieldPathSegment{name: part}
+		if name, ok := strings.CutSuffix(part, "[*]"); ok {
+			segment = fieldPathSegment{name: name, eachItem: true}
+		}
+		if segment.name == "" || strings.ContainsAny(segment.name, "[]*") {
+			return nil, fmt.Errorf("unsupported path segment %q", part)
+		}
+		path = append(path, segment)
+	}
+	return path, nil
+}
+
+// removeFields 去掉对象中的字段，结构化对象会被转换为无结构的形式处理后返回新的对象
+func removeFields(obj runtime.Object, fieldPaths [][]fieldPathSegment) (runtime.Object, error) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content := u.UnstructuredContent()
+		for _, path := range fieldPaths {
+			removeField(content, path)
+		}
+		return obj, nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("convert %T to unstructured error: %w", obj, err)
+	}
+	for _, path := range fieldPaths {
+		removeField(content, path)
+	}
+	ret := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, ret); err != nil {
+		return nil, fmt.Errorf("convert unstructured to %T error: %w", obj, err)
+	}
+	return ret, nil
+}
+
+// removeField 去掉无结构内容中指定路径的字段
+func removeField(value interface{}, path []fieldPathSegment) {
+	content, ok := value.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return
+	}
+	segment := path[0]
+	if len(path) == 1 {
+		delete(content, segment.name)
+		return
+	}
+	if !segment.eachItem {
+		removeField(content[segment.name], path[1:])
+		return
+	}
+	items, _ := content[segment.name].([]interface{})
+	for _, item := range items {
+		removeField(item, path[1:])
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestObjectTransform 测试裁剪缓存的对象
+func TestObjectTransform(t *testing.T) {
+	if transform, err := NewObjectTransform(TransformOptions{PassthroughFullObjectGets: true}); err != nil || transform != nil {
+		t.Errorf("expected nil transform, got: %v, %v", transform, err)
+	}
+	if _, err := NewObjectTransform(TransformOptions{StripFields: []string{".spec.containers[0]"}}); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+
+	transform, err := NewObjectTransform(TransformOptions{
+		StripManagedFields: true,
+		StripAnnotations:   []string{corev1.LastAppliedConfigAnnotation},
+		StripFields:        []string{".spec.containers[*].env", "{.status}"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 结构化对象
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:          "foo",
+			Annotations:   map[string]string{corev1.LastAppliedConfigAnnotation: "{}", "foo": "bar"},
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "foo",
+			Image: "foo:latest",
+			Env:   []corev1.EnvVar{{Name: "FOO", Value: "bar"}},
+		}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	out, err := transform(pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	outPod, ok := out.(*corev1.Pod)
+	if !ok {
+		t.Fatalf("expected *corev1.Pod, got: %T", out)
+	}
+	if outPod.ManagedFields != nil {
+		t.Errorf("expected no managed fields, got: %v", outPod.ManagedFields)
+	}
+	if len(outPod.Annotations) != 1 || outPod.Annotations["foo"] != "bar" {
+		t.Errorf("unexpected annotations: %v", outPod.Annotations)
+	}
+	if c := outPod.Spec.Containers[0]; c.Env != nil || c.Image != "foo:latest" {
+		t.Errorf("unexpected container: %v", c)
+	}
+	if outPod.Status.Phase != "" {
+		t.Errorf("expected empty status, got: %v", outPod.Status)
+	}
+
+	// 无结构对象
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Foo",
+		"metadata": map[string]interface{}{
+			"name":          "foo",
+			"annotations":   map[string]interface{}{corev1.LastAppliedConfigAnnotation: "{}"},
+			"managedFields": []interface{}{map[string]interface{}{"manager": "kubectl"}},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "foo", "env": []interface{}{}}},
+		},
+		"status": map[string]interface{}{"ready": true},
+	}}
+	out, err = transform(u)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	outU := out.(*unstructured.Unstructured)
+	if outU.GetManagedFields() != nil || outU.GetAnnotations() != nil {
+		t.Errorf("unexpected metadata: %v", outU.Object["metadata"])
+	}
+	containers, _, _ := unstructured.NestedSlice(outU.Object, "spec", "containers")
+	if _, ok := containers[0].(map[string]interface{})["env"]; ok || len(containers) != 1 {
+		t.Errorf("unexpected containers: %v", containers)
+	}
+	if _, ok := outU.Object["status"]; ok {
+		t.Errorf("expected no status, got: %v", outU.Object["status"])
+	}
+}
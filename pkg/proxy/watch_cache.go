@@ -0,0 +1,500 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/storage"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+const (
+	// defaultWatchCacheCapacity 默认缓存的最近事件数
+	defaultWatchCacheCapacity = 1024
+	// defaultWatcherBufferSize 每个 watcher 的事件缓冲大小
+	defaultWatcherBufferSize = 100
+	// resourceVersionTooLargeWaitTime 请求的资源版本比缓存新时最长等待时间
+	resourceVersionTooLargeWaitTime = 3 * time.Second
+)
+
+// errResourceVersionNotCached 缓存中没有请求的资源版本
+var errResourceVersionNotCached = errors.New("requested resource version is not available in cache")
+
+// newWatchCache 基于 informer 创建 watchCache
+//
+// informer 中已有的对象会作为初始状态载入，之后的变更事件会被记录在一个定长环形缓冲中，用于服务指定资源版本的 watch 请求
+func newWatchCache(
+	gvk schema.GroupVersionKind,
+	informer cache.Informer,
+	capacity int,
+) *watchCache {
+	indexers := toolscache.Indexers{
+		toolscache.NamespaceIndex: toolscache.MetaNamespaceIndexFunc,
+	}
+	// 标签倒排索引，用于匹配标签选择器
+	for name, indexFunc := range labelIndexers() {
+		indexers[name] = indexFunc
+	}
+	if indexerInformer, ok := informer.(toolscache.SharedIndexInformer); ok {
+		// 复用 informer 上注册的字段索引，用于匹配字段选择器
+		for name, indexFunc := range indexerInformer.GetIndexer().GetIndexers() {
+			indexers[name] = indexFunc
+		}
+	}
+	wc := &watchCache{
+		gvk:        gvk,
+		informer:   informer,
+		store:      toolscache.NewIndexer(toolscache.MetaNamespaceKeyFunc, indexers),
+		events:     make([]*watchCacheEvent, capacity),
+		watchers:   make(map[int]*cacheWatcher),
+		rvChangeCh: make(chan struct{}),
+	}
+	wc.Touch()
+	return wc
+}
+
+// watchCache 基于 informer 事件维护的资源缓存
+//
+// 除了维护与 informer 一致的对象存储外，还记录最近的变更事件，以支持从指定资源版本开始 watch
+type watchCache struct {
+	gvk      schema.GroupVersionKind
+	informer cache.Informer
+	store    toolscache.Indexer
+	// 是否仅缓存了元数据（对象为 PartialObjectMetadata ）
+	metadataOnly bool
+	// 创建 informer 前最近一次记录写入的序号，此前的写入已包含在 informer 首次列出的对象中
+	writeSeq uint64
+
+	lock sync.RWMutex
+	// 当前缓存反映的资源版本
+	resourceVersion uint64
+	// 能从缓存中开始 watch 的最早资源版本（不包含）
+	oldestResourceVersion uint64
+	// 资源版本发生变化时关闭并替换该通道
+	rvChangeCh chan struct{}
+
+	// 最近事件的环形缓冲
+	events     []*watchCacheEvent
+	startIndex int
+	count      int
+
+	watchers     map[int]*cacheWatcher
+	watcherIndex int
+
+	// 分页快照
+	snapshots []*listSnapshot
+
+	// 存储中对象估算的内存占用（字节）
+	memory int64
+	// 是否已停止，停止后不能再开始 watch
+	stopped bool
+
+	// 最近一次被使用的时间（ UnixNano ）
+	lastAccess atomic.Int64
+}
+
+// watchCacheEvent 缓存中的一个变更事件
+type watchCacheEvent struct {
+	Type            watch.EventType
+	Object          runtime.Object
+	PrevObject      runtime.Object
+	ResourceVersion uint64
+}
+
+var _ toolscache.ResourceEventHandler = toolscache.ResourceEventHandlerDetailedFuncs{}
+
+// EventHandler 返回用于注册到 informer 的事件处理器
+func (wc *watchCache) EventHandler() toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			wc.processEvent(watch.Added, obj, nil, isInInitialList)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			wc.processEvent(watch.Modified, newObj, oldObj, false)
+		},
+		DeleteFunc: func(obj interface{}) {
+			wc.processEvent(watch.Deleted, obj, nil, false)
+		},
+	}
+}
+
+// processEvent 处理 informer 事件
+func (wc *watchCache) processEvent(eventType watch.EventType, obj, prevObj interface{}, isInInitialList bool) {
+	// 删除事件可能是 informer 重新 list 后生成的墓碑，其资源版本不可信
+	tombstone := false
+	if deleted, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = deleted.Obj
+		tombstone = true
+	}
+	runtimeObj, ok := obj.(runtime.Object)
+	if !ok {
+		return
+	}
+	objMeta, err := meta.Accessor(runtimeObj)
+	if err != nil {
+		return
+	}
+	// 与 APIServer 一致，返回的对象带有 apiVersion 和 kind 。在对象进入缓存时设置一次，读取时不需要再拷贝对象
+	if runtimeObj.GetObjectKind().GroupVersionKind() != wc.gvk {
+		runtimeObj.GetObjectKind().SetGroupVersionKind(wc.gvk)
+	}
+	var prevRuntimeObj runtime.Object
+	if prevObj != nil {
+		prevRuntimeObj, _ = prevObj.(runtime.Object)
+		// informer 周期性 resync 产生的更新事件，对象实际没有变化
+		if prevMeta, err := meta.Accessor(prevRuntimeObj); err == nil &&
+			prevMeta.GetResourceVersion() == objMeta.GetResourceVersion() {
+			return
+		}
+	}
+	rv, rvErr := parseResourceVersion(objMeta.GetResourceVersion())
+
+	wc.lock.Lock()
+	defer wc.lock.Unlock()
+
+	// 更新存储和估算的内存占用
+	if old, exists, _ := wc.store.Get(runtimeObj); exists {
+		if oldObj, ok := old.(runtime.Object); ok {
+			wc.memory -= estimateObjectSize(oldObj)
+		}
+	}
+	switch eventType {
+	case watch.Added, watch.Modified:
+		_ = wc.store.Update(runtimeObj)
+		wc.memory += estimateObjectSize(runtimeObj)
+	case watch.Deleted:
+		_ = wc.store.Delete(runtimeObj)
+	}
+
+	if isInInitialList {
+		// 初始 list 的对象不作为事件记录
+		if rvErr == nil && rv > wc.resourceVersion {
+			wc.setResourceVersionLocked(rv)
+		}
+		wc.oldestResourceVersion = wc.resourceVersion
+		return
+	}
+
+	if tombstone || rvErr != nil || rv <= wc.resourceVersion {
+		// 事件顺序无法保证，丢弃已记录的事件，此前的资源版本都不能再从缓存 watch
+		wc.startIndex = 0
+		wc.count = 0
+		wc.oldestResourceVersion = wc.resourceVersion
+		rv = wc.resourceVersion
+	} else {
+		wc.setResourceVersionLocked(rv)
+	}
+
+	event := &watchCacheEvent{
+		Type:            eventType,
+		Object:          runtimeObj,
+		PrevObject:      prevRuntimeObj,
+		ResourceVersion: rv,
+	}
+
+	// 记录事件
+	capacity := len(wc.events)
+	if capacity > 0 {
+		if wc.count == capacity {
+			// 缓冲已满，淘汰最早的事件
+			wc.oldestResourceVersion = wc.events[wc.startIndex].ResourceVersion
+			wc.startIndex = (wc.startIndex + 1) % capacity
+			wc.count--
+		}
+		wc.events[(wc.startIndex+wc.count)%capacity] = event
+		wc.count++
+	} else {
+		wc.oldestResourceVersion = wc.resourceVersion
+	}
+
+	// 分发给 watcher
+	for id, watcher := range wc.watchers {
+		if !watcher.add(event) {
+			// 消费过慢的 watcher 直接结束，客户端会从最后收到的资源版本重新 watch
+			delete(wc.watchers, id)
+			watcher.stopLocked()
+		}
+	}
+}
+
+// setResourceVersionLocked 设置当前资源版本并通知等待者
+func (wc *watchCache) setResourceVersionLocked(rv uint64) {
+	wc.resourceVersion = rv
+	close(wc.rvChangeCh)
+	wc.rvChangeCh = make(chan struct{})
+}
+
+// ResourceVersion 返回当前缓存反映的资源版本
+func (wc *watchCache) ResourceVersion() uint64 {
+	wc.lock.RLock()
+	defer wc.lock.RUnlock()
+	return wc.resourceVersion
+}
+
+// WaitUntilFresh 等待缓存资源版本不小于 rv
+//
+// 缓存资源版本只随已处理的事件推进。 informer 报告的资源版本（比如收到的书签）不能采纳，
+// 因为 informer 向事件处理器的分发是异步的，此前的事件可能还未被处理
+func (wc *watchCache) WaitUntilFresh(ctx context.Context, rv uint64) error {
+	for {
+		wc.lock.RLock()
+		current := wc.resourceVersion
+		ch := wc.rvChangeCh
+		wc.lock.RUnlock()
+		if current >= rv {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// Get 从缓存获取对象，返回的对象与缓存共享，不能修改
+func (wc *watchCache) Get(namespace, name string) (runtime.Object, bool, error) {
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	item, exists, err := wc.store.GetByKey(key)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	obj, ok := item.(runtime.Object)
+	if !ok {
+		return nil, false, fmt.Errorf("cache contained %T, which is not an Object", item)
+	}
+	return obj, true, nil
+}
+
+// Watch 从指定资源版本开始 watch 缓存
+//
+// resourceVersion 为空或 "0" 时，先以 ADDED 事件返回当前所有对象，再返回之后的变更。
+// 请求的资源版本比缓存新且等待超时时返回 errPassthrough
+func (wc *watchCache) Watch(
+	ctx context.Context,
+	namespace string,
+	opts metav1.ListOptions,
+) (*cacheWatcher, error) {
+	var initEvents []*watchCacheEvent
+	sendInitialEvents := opts.SendInitialEvents != nil && *opts.SendInitialEvents
+
+	rv, err := parseResourceVersion(opts.ResourceVersion)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	fromState := sendInitialEvents || rv == 0
+	if rv > 0 {
+		// 请求的资源版本比缓存新时，等待缓存追上
+		waitCtx, cancel := context.WithTimeout(ctx, resourceVersionTooLargeWaitTime)
+		err = wc.WaitUntilFresh(waitCtx, rv)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%w: %w", errPassthrough, storage.NewTooLargeResourceVersionError(rv, wc.ResourceVersion(), 1))
+		}
+	}
+
+	wc.lock.Lock()
+	defer wc.lock.Unlock()
+
+	if wc.stopped {
+		// informer 已被停止，不会再有事件
+		return nil, fmt.Errorf("%w: watch cache for %s stopped", errPassthrough, wc.gvk)
+	}
+
+	if fromState {
+		var items []interface{}
+		if namespace != "" {
+			items, _ = wc.store.ByIndex(toolscache.NamespaceIndex, namespace)
+		} else {
+			items = wc.store.List()
+		}
+		initEvents = make([]*watchCacheEvent, 0, len(items))
+		for _, item := range items {
+			obj, ok := item.(runtime.Object)
+			if !ok {
+				continue
+			}
+			initEvents = append(initEvents, &watchCacheEvent{
+				Type:            watch.Added,
+				Object:          obj,
+				ResourceVersion: wc.resourceVersion,
+			})
+		}
+	} else {
+		if rv < wc.oldestResourceVersion {
+			return nil, apierrors.NewResourceExpired(fmt.Sprintf(
+				"too old resource version: %d (%d)", rv, wc.oldestResourceVersion,
+			))
+		}
+		for i := 0; i < wc.count; i++ {
+			event := wc.events[(wc.startIndex+i)%len(wc.events)]
+			if event.ResourceVersion > rv && eventInNamespace(event, namespace) {
+				initEvents = append(initEvents, event)
+			}
+		}
+	}
+
+	watcher := &cacheWatcher{
+		namespace:         namespace,
+		initEvents:        initEvents,
+		initEventsEndRV:   wc.resourceVersion,
+		sendInitialEvents: sendInitialEvents,
+		input:             make(chan *watchCacheEvent, defaultWatcherBufferSize),
+		done:              make(chan struct{}),
+	}
+	watcher.forget = func() {
+		wc.lock.Lock()
+		defer wc.lock.Unlock()
+		if _, ok := wc.watchers[watcher.id]; ok {
+			delete(wc.watchers, watcher.id)
+			watcher.stopLocked()
+		}
+	}
+	wc.watcherIndex++
+	watcher.id = wc.watcherIndex
+	wc.watchers[watcher.id] = watcher
+
+	return watcher, nil
+}
+
+// Touch 记录缓存被使用
+func (wc *watchCache) Touch() {
+	wc.lastAccess.Store(time.Now().UnixNano())
+}
+
+// IdleTime 返回缓存距最近一次被使用的时间
+func (wc *watchCache) IdleTime() time.Duration {
+	return time.Since(time.Unix(0, wc.lastAccess.Load()))
+}
+
+// Watching 判断是否有进行中的 watch
+func (wc *watchCache) Watching() bool {
+	wc.lock.RLock()
+	defer wc.lock.RUnlock()
+	return len(wc.watchers) > 0
+}
+
+// Memory 返回存储中对象估算的内存占用（字节）
+func (wc *watchCache) Memory() int64 {
+	wc.lock.RLock()
+	defer wc.lock.RUnlock()
+	return wc.memory
+}
+
+// Stop 结束所有 watcher ，缓存不再使用时调用
+func (wc *watchCache) Stop() {
+	wc.lock.Lock()
+	defer wc.lock.Unlock()
+	wc.stopped = true
+	for id, watcher := range wc.watchers {
+		delete(wc.watchers, id)
+		watcher.stopLocked()
+	}
+}
+
+// cacheWatcher 缓存的一个 watcher
+type cacheWatcher struct {
+	id        int
+	namespace string
+
+	// 开始 watch 时需要先发送的事件
+	initEvents []*watchCacheEvent
+	// 初始事件对应的资源版本
+	initEventsEndRV uint64
+	// 是否在初始事件后发送 initial-events-end 书签
+	sendInitialEvents bool
+
+	input   chan *watchCacheEvent
+	done    chan struct{}
+	stopped bool
+	forget  func()
+}
+
+// add 添加事件，缓冲已满时返回 false
+func (w *cacheWatcher) add(event *watchCacheEvent) bool {
+	if !eventInNamespace(event, w.namespace) {
+		return true
+	}
+	select {
+	case w.input <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopLocked 停止 watcher ，需要持有 watchCache 的锁
+func (w *cacheWatcher) stopLocked() {
+	if !w.stopped {
+		w.stopped = true
+		close(w.done)
+	}
+}
+
+// Stop 停止 watcher
+func (w *cacheWatcher) Stop() {
+	w.forget()
+}
+
+// InitEvents 返回开始 watch 时需要先发送的事件
+func (w *cacheWatcher) InitEvents() []*watchCacheEvent {
+	return w.initEvents
+}
+
+// ResultChan 返回事件通道
+func (w *cacheWatcher) ResultChan() <-chan *watchCacheEvent {
+	return w.input
+}
+
+// Done 返回一个通道，该通道在 watcher 被缓存结束时关闭
+func (w *cacheWatcher) Done() <-chan struct{} {
+	return w.done
+}
+
+// eventInNamespace 判断事件对象是否属于指定命名空间，命名空间为空时总是返回 true
+func eventInNamespace(event *watchCacheEvent, namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+	objMeta, err := meta.Accessor(event.Object)
+	return err == nil && objMeta.GetNamespace() == namespace
+}
+
+// parseResourceVersion 解析资源版本
+func parseResourceVersion(rv string) (uint64, error) {
+	if rv == "" {
+		return 0, nil
+	}
+	ret, err := strconv.ParseUint(rv, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid resource version %q: %w", rv, err)
+	}
+	return ret, nil
+}
+
+// formatResourceVersion 格式化资源版本
+func formatResourceVersion(rv uint64) string {
+	if rv == 0 {
+		return ""
+	}
+	return strconv.FormatUint(rv, 10)
+}
@@ -0,0 +1,356 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/storage"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	// continueTokenTTL 分页快照保留时长，超过后对应的 continue 参数过期
+	continueTokenTTL = 5 * time.Minute
+	// maxListSnapshots 每个资源最多保留的分页快照数
+	maxListSnapshots = 16
+
+	// continueKeyPrefix 编码 continue 参数时使用的键前缀
+	continueKeyPrefix = "/"
+
+	continueExpired = "The provided continue parameter is too old " +
+		"to display a consistent list result. You can start a new list without " +
+		"the continue parameter."
+	inconsistentContinue = "The provided continue parameter is too old " +
+		"to display a consistent list result. You can start a new list without " +
+		"the continue parameter, or use the continue token in this response to " +
+		"retrieve the remainder of the results. Continuing with the provided " +
+		"token results in an inconsistent list - objects that were created, " +
+		"modified, or deleted between the time the first chunk was returned " +
+		"and now may show up in the list."
+)
+
+// listResult 从缓存列出对象的结果
+type listResult struct {
+	// 匹配的对象，与缓存共享，不能修改
+	Items []runtime.Object
+	// 结果对应的资源版本
+	ResourceVersion uint64
+	// 获取下一页的 continue 参数
+	Continue string
+	// 剩余对象数
+	RemainingItemCount *int64
+}
+
+// listSnapshot 某个资源版本下按键排序的对象快照，用于一致地分页
+type listSnapshot struct {
+	resourceVersion uint64
+	namespace       string
+	keys            []string
+	objects         []runtime.Object
+	createdAt       time.Time
+}
+
+// List 列出缓存中匹配选择器的对象，结果按键（ namespace/name ）排序
+//
+// 设置了 limit 或 continue 时分页返回，同一次分页的所有页都基于第一页时的快照。
+// 要求精确匹配资源版本时，只能基于该版本的快照列出，没有对应快照时返回 errResourceVersionNotCached
+func (wc *watchCache) List(
+	namespace string,
+	opts metav1.ListOptions,
+	labelSelector labels.Selector,
+	fieldSelector fields.Selector,
+) (*listResult, error) {
+	exact := isExactResourceVersionMatch(opts)
+	if opts.Limit <= 0 && opts.Continue == "" && !exact {
+		return wc.listAll(namespace, labelSelector, fieldSelector)
+	}
+
+	// 获取快照
+	var snapshot *listSnapshot
+	startKey := ""
+	switch {
+	case exact:
+		rv, err := parseResourceVersion(opts.ResourceVersion)
+		if err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+		if snapshot = wc.getSnapshot(rv, namespace); snapshot == nil {
+			return nil, errResourceVersionNotCached
+		}
+	case opts.Continue != "":
+		key, rv, err := storage.DecodeContinue(opts.Continue, continueKeyPrefix)
+		if err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+		}
+		startKey = strings.TrimPrefix(key, continueKeyPrefix)
+		if rv < 0 {
+			// 客户端接受不一致的分页，从最新版本继续
+			snapshot = wc.currentSnapshot(namespace)
+		} else if snapshot = wc.getSnapshot(uint64(rv), namespace); snapshot == nil {
+			return nil, newContinueExpiredError(key)
+		}
+	default:
+		snapshot = wc.currentSnapshot(namespace)
+	}
+
+	// 从起始键开始取一页
+	ret := &listResult{ResourceVersion: snapshot.resourceVersion}
+	indexers := wc.store.GetIndexers()
+	lastIndex := -1
+	i := sort.SearchStrings(snapshot.keys, startKey)
+	for ; i < len(snapshot.keys); i++ {
+		obj := snapshot.objects[i]
+		matched, err := matchSelectors(indexers, obj, labelSelector, fieldSelector)
+		if err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+		if !matched {
+			continue
+		}
+		if opts.Limit > 0 && int64(len(ret.Items)) >= opts.Limit {
+			// 还有更多结果
+			break
+		}
+		ret.Items = append(ret.Items, obj)
+		lastIndex = i
+	}
+	if i >= len(snapshot.keys) {
+		return ret, nil
+	}
+
+	// 生成下一页的 continue 参数
+	var err error
+	ret.Continue, err = storage.EncodeContinue(
+		continueKeyPrefix+snapshot.keys[lastIndex]+"\x00",
+		continueKeyPrefix,
+		int64(snapshot.resourceVersion),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("encode continue token error: %w", err)
+	}
+	if labelSelector.Empty() && fieldSelector.Empty() {
+		remaining := int64(len(snapshot.keys) - lastIndex - 1)
+		ret.RemainingItemCount = &remaining
+	}
+	wc.saveSnapshot(snapshot)
+
+	return ret, nil
+}
+
+// listAll 不分页列出所有匹配的对象
+//
+// 字段选择器中的相等条件和标签选择器的大部分条件先通过索引取交集缩小范围（见 selectKeysByIndexes ），
+// 范围内的对象再用完整的选择器逐个过滤
+func (wc *watchCache) listAll(
+	namespace string,
+	labelSelector labels.Selector,
+	fieldSelector fields.Selector,
+) (*listResult, error) {
+	wc.lock.RLock()
+	defer wc.lock.RUnlock()
+
+	indexers := wc.store.GetIndexers()
+	for _, req := range fieldSelector.Requirements() {
+		if _, ok := indexers[fieldIndexName(req.Field)]; !ok {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("field label not supported: %s", req.Field))
+		}
+	}
+
+	// 优先使用索引缩小范围
+	var items []interface{}
+	keys, indexed, err := wc.selectKeysByIndexes(namespace, labelSelector, fieldSelector)
+	if err != nil {
+		return nil, err
+	}
+	if indexed {
+		items = make([]interface{}, 0, len(keys))
+		for key := range keys {
+			if item, exists, _ := wc.store.GetByKey(key); exists {
+				items = append(items, item)
+			}
+		}
+	} else if namespace != "" {
+		if items, err = wc.store.ByIndex(toolscache.NamespaceIndex, namespace); err != nil {
+			return nil, err
+		}
+	} else {
+		items = wc.store.List()
+	}
+
+	ret := &listResult{
+		ResourceVersion: wc.resourceVersion,
+		Items:           make([]runtime.Object, 0, len(items)),
+	}
+	for _, item := range items {
+		obj, ok := item.(runtime.Object)
+		if !ok {
+			continue
+		}
+		matched, err := matchSelectors(indexers, obj, labelSelector, fieldSelector)
+		if err != nil {
+			return nil, apierrors.NewBadRequest(err.Error())
+		}
+		if matched {
+			ret.Items = append(ret.Items, obj)
+		}
+	}
+	sortObjectsByKey(ret.Items)
+
+	return ret, nil
+}
+
+// currentSnapshot 获取当前资源版本的快照
+func (wc *watchCache) currentSnapshot(namespace string) *listSnapshot {
+	wc.lock.RLock()
+	defer wc.lock.RUnlock()
+
+	if snapshot := wc.getSnapshotLocked(wc.resourceVersion, namespace); snapshot != nil {
+		return snapshot
+	}
+
+	var items []interface{}
+	if namespace != "" {
+		items, _ = wc.store.ByIndex(toolscache.NamespaceIndex, namespace)
+	} else {
+		items = wc.store.List()
+	}
+	objs := make([]runtime.Object, 0, len(items))
+	for _, item := range items {
+		if obj, ok := item.(runtime.Object); ok {
+			objs = append(objs, obj)
+		}
+	}
+	keys := sortObjectsByKey(objs)
+	return &listSnapshot{
+		resourceVersion: wc.resourceVersion,
+		namespace:       namespace,
+		keys:            keys,
+		objects:         objs,
+		createdAt:       time.Now(),
+	}
+}
+
+// getSnapshot 获取指定资源版本的快照，没有时返回 nil
+func (wc *watchCache) getSnapshot(rv uint64, namespace string) *listSnapshot {
+	wc.lock.RLock()
+	snapshot := wc.getSnapshotLocked(rv, namespace)
+	current := wc.resourceVersion
+	wc.lock.RUnlock()
+
+	if snapshot == nil && rv == current {
+		// 此后没有变化，当前状态即为该版本的快照
+		if snapshot = wc.currentSnapshot(namespace); snapshot.resourceVersion != rv {
+			return nil
+		}
+	}
+	return snapshot
+}
+
+// getSnapshotLocked 获取已保存的指定资源版本的快照，需要持有锁
+func (wc *watchCache) getSnapshotLocked(rv uint64, namespace string) *listSnapshot {
+	for _, snapshot := range wc.snapshots {
+		if snapshot.resourceVersion == rv && snapshot.namespace == namespace &&
+			time.Since(snapshot.createdAt) < continueTokenTTL {
+			return snapshot
+		}
+	}
+	return nil
+}
+
+// saveSnapshot 保存快照以服务后续分页请求
+func (wc *watchCache) saveSnapshot(snapshot *listSnapshot) {
+	wc.lock.Lock()
+	defer wc.lock.Unlock()
+
+	// 清理过期快照
+	snapshots := make([]*listSnapshot, 0, len(wc.snapshots)+1)
+	for _, s := range wc.snapshots {
+		if s == snapshot || time.Since(s.createdAt) >= continueTokenTTL {
+			continue
+		}
+		snapshots = append(snapshots, s)
+	}
+	snapshots = append(snapshots, snapshot)
+	// 超出数量限制时淘汰最早的快照
+	if len(snapshots) > maxListSnapshots {
+		snapshots = snapshots[len(snapshots)-maxListSnapshots:]
+	}
+	wc.snapshots = snapshots
+}
+
+// isExactResourceVersionMatch 判断列表请求是否要求精确匹配资源版本
+//
+// 与 APIServer 一致，未指定 resourceVersionMatch 时，设置了 limit 且 resourceVersion 非 "0" 的请求也要求精确匹配
+func isExactResourceVersionMatch(opts metav1.ListOptions) bool {
+	switch opts.ResourceVersionMatch {
+	case metav1.ResourceVersionMatchExact:
+		return true
+	case "":
+		return opts.Limit > 0 && opts.Continue == "" &&
+			opts.ResourceVersion != "" && opts.ResourceVersion != "0"
+	}
+	return false
+}
+
+// newContinueExpiredError 创建 continue 参数过期错误，并附带从最新版本继续的 continue 参数
+func newContinueExpiredError(key string) error {
+	newToken, err := storage.EncodeContinue(key, continueKeyPrefix, -1)
+	if err != nil {
+		return apierrors.NewResourceExpired(continueExpired)
+	}
+	statusError := apierrors.NewResourceExpired(inconsistentContinue)
+	statusError.ErrStatus.ListMeta.Continue = newToken
+	return statusError
+}
+
+// matchSelectors 判断对象是否匹配标签选择器和字段选择器
+func matchSelectors(
+	indexers toolscache.Indexers,
+	obj runtime.Object,
+	labelSelector labels.Selector,
+	fieldSelector fields.Selector,
+) (bool, error) {
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return false, err
+	}
+	if !labelSelector.Matches(labels.Set(objMeta.GetLabels())) {
+		return false, nil
+	}
+	return matchFieldSelector(indexers, obj, fieldSelector)
+}
+
+// sortObjectsByKey 将对象按在缓存中的键（ namespace/name ）升序排序，并返回排序后的键
+//
+// 与 APIServer 从 etcd 列出对象的顺序一致
+func sortObjectsByKey(objs []runtime.Object) []string {
+	keys := make([]string, len(objs))
+	for i, obj := range objs {
+		keys[i], _ = toolscache.MetaNamespaceKeyFunc(obj)
+	}
+	sort.Sort(objectsByKey{keys: keys, objs: objs})
+	return keys
+}
+
+// objectsByKey 用于将对象按键排序
+type objectsByKey struct {
+	keys []string
+	objs []runtime.Object
+}
+
+var _ sort.Interface = objectsByKey{}
+
+func (s objectsByKey) Len() int           { return len(s.keys) }
+func (s objectsByKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s objectsByKey) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.objs[i], s.objs[j] = s.objs[j], s.objs[i]
+}
@@ -0,0 +1,330 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/storage"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// newTestPod 创建用于测试的 Pod
+func newTestPod(namespace, name, rv string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, ResourceVersion: rv}}
+}
+
+// TestWatchCache 测试 watchCache 记录事件和从指定资源版本 watch
+func TestWatchCache(t *testing.T) {
+	wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), nil, 2)
+	handler := wc.EventHandler()
+
+	handler.OnAdd(newTestPod("default", "a", "10"), true)
+	handler.OnAdd(newTestPod("default", "b", "11"), true)
+	if rv := wc.ResourceVersion(); rv != 11 {
+		t.Fatalf("expected resource version 11, got: %d", rv)
+	}
+
+	handler.OnUpdate(newTestPod("default", "a", "10"), newTestPod("default", "a", "12"))
+	handler.OnAdd(newTestPod("other", "c", "13"), false)
+
+	// 从当前状态开始
+	w, err := wc.Watch(context.Background(), "default", metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("watch error: %v", err)
+	}
+	if n := len(w.InitEvents()); n != 2 {
+		t.Errorf("expected 2 init events, got: %d", n)
+	}
+	w.Stop()
+
+	// 从指定资源版本开始
+	w, err = wc.Watch(context.Background(), "", metav1.ListOptions{ResourceVersion: "11"})
+	if err != nil {
+		t.Fatalf("watch error: %v", err)
+	}
+	events := w.InitEvents()
+	if len(events) != 2 || events[0].Type != watch.Modified || events[1].ResourceVersion != 13 {
+		t.Errorf("unexpected init events: %#v", events)
+	}
+
+	// 新事件分发给 watcher
+	handler.OnDelete(newTestPod("default", "b", "14"))
+	select {
+	case event := <-w.ResultChan():
+		if event.Type != watch.Deleted || event.ResourceVersion != 14 {
+			t.Errorf("unexpected event: %#v", event)
+		}
+	default:
+		t.Errorf("expected an event")
+	}
+	w.Stop()
+
+	// 超出缓冲的资源版本已过期
+	_, err = wc.Watch(context.Background(), "", metav1.ListOptions{ResourceVersion: "11"})
+	if !apierrors.IsResourceExpired(err) {
+		t.Errorf("expected resource expired error, got: %v", err)
+	}
+
+	// 等待不到比缓存新的资源版本时直连
+	_, err = wc.Watch(context.Background(), "", metav1.ListOptions{ResourceVersion: "100"})
+	if !errors.Is(err, errPassthrough) || !storage.IsTooLargeResourceVersion(err) {
+		t.Errorf("expected passthrough too large resource version error, got: %v", err)
+	}
+}
+
+// progressInformer 报告指定资源版本进度的 informer
+type progressInformer struct {
+	cache.Informer
+	rv string
+}
+
+// LastSyncResourceVersion 返回 informer 观察到的资源版本
+func (i *progressInformer) LastSyncResourceVersion() string {
+	return i.rv
+}
+
+// TestWatchCacheDelayedDelivery 测试 informer 向事件处理器的分发落后于 informer 观察到的资源版本时，
+// 缓存资源版本只随已处理的事件推进
+func TestWatchCacheDelayedDelivery(t *testing.T) {
+	// informer 已经观察到资源版本 13 ，但 12 、 13 的事件还未分发
+	informer := &progressInformer{rv: "13"}
+	wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), informer, 10)
+	handler := wc.EventHandler()
+	handler.OnAdd(newTestPod("default", "a", "10"), true)
+	handler.OnAdd(newTestPod("default", "b", "11"), true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	err := wc.WaitUntilFresh(ctx, 13)
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got: %v", err)
+	}
+	if rv := wc.ResourceVersion(); rv != 11 {
+		t.Fatalf("expected resource version 11, got: %d", rv)
+	}
+
+	w, err := wc.Watch(context.Background(), "", metav1.ListOptions{ResourceVersion: "11"})
+	if err != nil {
+		t.Fatalf("watch error: %v", err)
+	}
+	defer w.Stop()
+
+	// 延迟分发的事件到达
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		handler.OnUpdate(newTestPod("default", "a", "10"), newTestPod("default", "a", "12"))
+		handler.OnAdd(newTestPod("default", "c", "13"), false)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := wc.WaitUntilFresh(ctx, 13); err != nil {
+		t.Fatalf("wait until fresh error: %v", err)
+	}
+	for _, expected := range []uint64{12, 13} {
+		select {
+		case event := <-w.ResultChan():
+			if event.ResourceVersion != expected {
+				t.Errorf("expected event at resource version %d, got: %d", expected, event.ResourceVersion)
+			}
+		case <-w.Done():
+			t.Fatalf("watcher stopped unexpectedly")
+		}
+	}
+
+	// 延迟的事件没有使已记录的事件失效
+	w2, err := wc.Watch(context.Background(), "", metav1.ListOptions{ResourceVersion: "11"})
+	if err != nil {
+		t.Fatalf("watch error: %v", err)
+	}
+	defer w2.Stop()
+	if n := len(w2.InitEvents()); n != 2 {
+		t.Errorf("expected 2 init events, got: %d", n)
+	}
+}
+
+// TestWatchCacheListPagination 测试 watchCache 分页列出对象
+func TestWatchCacheListPagination(t *testing.T) {
+	wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), nil, 10)
+	handler := wc.EventHandler()
+	for i, name := range []string{"e", "d", "c", "b", "a"} {
+		handler.OnAdd(newTestPod("default", name, strconv.Itoa(10+i)), true)
+	}
+
+	// 第一页
+	ret, err := wc.List("default", metav1.ListOptions{Limit: 2}, labels.Everything(), fields.Everything())
+	if err != nil {
+		t.Fatalf("list error: %v", err)
+	}
+	if len(ret.Items) != 2 || ret.Items[0].(*corev1.Pod).Name != "a" || ret.Continue == "" ||
+		ret.RemainingItemCount == nil || *ret.RemainingItemCount != 3 {
+		t.Fatalf("unexpected first page: %#v", ret)
+	}
+
+	// 第一页之后的变更不影响后续分页
+	handler.OnDelete(newTestPod("default", "c", "20"))
+	ret, err = wc.List("default", metav1.ListOptions{Limit: 2, Continue: ret.Continue}, labels.Everything(), fields.Everything())
+	if err != nil {
+		t.Fatalf("list error: %v", err)
+	}
+	if len(ret.Items) != 2 || ret.Items[0].(*corev1.Pod).Name != "c" || ret.ResourceVersion != 14 {
+		t.Fatalf("unexpected second page: %#v", ret)
+	}
+
+	// 最后一页
+	ret, err = wc.List("default", metav1.ListOptions{Limit: 2, Continue: ret.Continue}, labels.Everything(), fields.Everything())
+	if err != nil {
+		t.Fatalf("list error: %v", err)
+	}
+	if len(ret.Items) != 1 || ret.Continue != "" {
+		t.Fatalf("unexpected last page: %#v", ret)
+	}
+
+	// 快照不存在时 continue 参数过期
+	wc.snapshots = nil
+	token, _ := storage.EncodeContinue("/default/b\x00", "/", 14)
+	_, err = wc.List("default", metav1.ListOptions{Limit: 2, Continue: token}, labels.Everything(), fields.Everything())
+	if !apierrors.IsResourceExpired(err) {
+		t.Errorf("expected resource expired error, got: %v", err)
+	}
+}
+
+// TestWatchCacheListExact 测试 watchCache 精确匹配资源版本列出对象
+func TestWatchCacheListExact(t *testing.T) {
+	wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), nil, 10)
+	handler := wc.EventHandler()
+	handler.OnAdd(newTestPod("default", "a", "10"), true)
+	handler.OnAdd(newTestPod("default", "b", "11"), true)
+
+	// 当前资源版本
+	opts := metav1.ListOptions{ResourceVersion: "11", ResourceVersionMatch: metav1.ResourceVersionMatchExact}
+	ret, err := wc.List("", opts, labels.Everything(), fields.Everything())
+	if err != nil {
+		t.Fatalf("list error: %v", err)
+	}
+	if len(ret.Items) != 2 || ret.ResourceVersion != 11 || ret.Continue != "" {
+		t.Fatalf("unexpected result: %#v", ret)
+	}
+
+	// 缓存中没有的资源版本
+	handler.OnAdd(newTestPod("default", "c", "12"), false)
+	_, err = wc.List("", opts, labels.Everything(), fields.Everything())
+	if !errors.Is(err, errResourceVersionNotCached) {
+		t.Errorf("expected errResourceVersionNotCached, got: %v", err)
+	}
+
+	// 设置了 limit 的旧式请求同样要求精确匹配
+	_, err = wc.List("", metav1.ListOptions{ResourceVersion: "11", Limit: 1}, labels.Everything(), fields.Everything())
+	if !errors.Is(err, errResourceVersionNotCached) {
+		t.Errorf("expected errResourceVersionNotCached, got: %v", err)
+	}
+}
+
+// TestWatchCacheListFieldSelector 测试 watchCache 按字段选择器列出对象
+func TestWatchCacheListFieldSelector(t *testing.T) {
+	wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), nil, 10)
+	if err := wc.store.AddIndexers(toolscache.Indexers{
+		fieldIndexName("status.phase"): func(obj interface{}) ([]string, error) {
+			phase := string(obj.(*corev1.Pod).Status.Phase)
+			return []string{namespacedIndexKey("", phase), namespacedIndexKey("default", phase)}, nil
+		},
+	}); err != nil {
+		t.Fatalf("add indexers error: %v", err)
+	}
+	handler := wc.EventHandler()
+	for i, phase := range []corev1.PodPhase{corev1.PodRunning, corev1.PodPending, corev1.PodRunning, corev1.PodFailed} {
+		pod := newTestPod("default", strconv.Itoa(i), strconv.Itoa(10+i))
+		pod.Status.Phase = phase
+		handler.OnAdd(pod, true)
+	}
+
+	for selector, expected := range map[string]int{
+		"status.phase=Running":                        2,
+		"status.phase!=Running":                       2,
+		"status.phase!=Running,status.phase!=Pending": 1,
+		"status.phase=Running,metadata.name!=0":       -1,
+	} {
+		ret, err := wc.List("default", metav1.ListOptions{}, labels.Everything(), fields.ParseSelectorOrDie(selector))
+		if expected < 0 {
+			// 未索引的字段
+			if !apierrors.IsBadRequest(err) {
+				t.Errorf("%q: expected bad request error, got: %v", selector, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: list error: %v", selector, err)
+		}
+		if len(ret.Items) != expected {
+			t.Errorf("%q: expected %d items, got: %d", selector, expected, len(ret.Items))
+		}
+	}
+}
+
+// TestWatchCacheListLabelSelector 测试基于标签倒排索引列出对象
+func TestWatchCacheListLabelSelector(t *testing.T) {
+	wc := newWatchCache(corev1.SchemeGroupVersion.WithKind("Pod"), nil, 10)
+	handler := wc.EventHandler()
+	for i, podLabels := range []map[string]string{
+		{"app": "foo", "tier": "web"},
+		{"app": "foo"},
+		{"app": "bar", "tier": "db"},
+		nil,
+	} {
+		pod := newTestPod("default", strconv.Itoa(i), strconv.Itoa(10+i))
+		pod.Labels = podLabels
+		handler.OnAdd(pod, true)
+	}
+	otherPod := newTestPod("other", "x", "20")
+	otherPod.Labels = map[string]string{"app": "foo"}
+	handler.OnAdd(otherPod, false)
+
+	for selector, expected := range map[string][]string{
+		"app=foo":               {"0", "1"},
+		"app in (foo,bar)":      {"0", "1", "2"},
+		"app=foo,tier":          {"0"},
+		"app,!tier":             {"1"},
+		"app!=foo":              {"2", "3"},
+		"app notin (foo),!tier": {"3"},
+		"tier=web,app=bar":      nil,
+	} {
+		labelSelector, err := labels.Parse(selector)
+		if err != nil {
+			t.Fatalf("%q: parse selector error: %v", selector, err)
+		}
+		ret, err := wc.List("default", metav1.ListOptions{}, labelSelector, fields.Everything())
+		if err != nil {
+			t.Fatalf("%q: list error: %v", selector, err)
+		}
+		var names []string
+		for _, item := range ret.Items {
+			names = append(names, item.(*corev1.Pod).Name)
+		}
+		if !slices.Equal(names, expected) {
+			t.Errorf("%q: expected %v, got: %v", selector, expected, names)
+		}
+	}
+
+	// 标签变化后索引随之更新
+	updated := otherPod.DeepCopy()
+	updated.ResourceVersion = "21"
+	updated.Labels = map[string]string{"app": "bar"}
+	handler.OnUpdate(otherPod, updated)
+	ret, err := wc.List("", metav1.ListOptions{}, labels.SelectorFromSet(labels.Set{"app": "bar"}), fields.Everything())
+	if err != nil {
+		t.Fatalf("list error: %v", err)
+	}
+	if len(ret.Items) != 2 {
+		t.Errorf("expected 2 items, got: %d", len(ret.Items))
+	}
+}
@@ -0,0 +1,341 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/streaming"
+	"k8s.io/apimachinery/pkg/watch"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	// watchBookmarkInterval 发送书签事件的间隔
+	watchBookmarkInterval = time.Minute
+)
+
+// ServeWatch 基于缓存处理 watch 请求
+func (h *CacheProxyHandler) ServeWatch(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	logger := logr.FromContextOrDiscard(ctx)
+
+	info, gvr, gvk, err := h.resolveRequest(req)
+	if err != nil {
+		h.writeError(w, req, err)
+		return
+	}
+	serializerInfo, target, err := negotiateResponse(req, streamingSerializers(h.serializers), false, h.scheme.Recognizes(gvk))
+	if err != nil {
+		h.writeError(w, req, err)
+		return
+	}
+	opts, err := ParseListOptions(req)
+	if err != nil {
+		h.writeError(w, req, apierrors.NewBadRequest(fmt.Sprintf("parse list options error: %v", err)))
+		return
+	}
+	if info.Name != "" {
+		// 通过 /watch/namespaces/{namespace}/{resource}/{name} 路径 watch 单个对象
+		nameSelector := fields.OneTermEqualSelector("metadata.name", info.Name).String()
+		if opts.FieldSelector != "" {
+			nameSelector += "," + opts.FieldSelector
+		}
+		opts.FieldSelector = nameSelector
+	}
+	labelSelector, fieldSelector, err := parseSelectors(opts)
+	if err != nil {
+		h.writeError(w, req, err)
+		return
+	}
+
+	wc, err := h.ensureInformer(ctx, gvr, info.Namespace)
+	if err != nil {
+		h.writeError(w, req, fmt.Errorf("ensure informer for %s error: %w", gvr, err))
+		return
+	}
+	var tableOptions *metav1.TableOptions
+	if target.Kind == kindTable {
+		if tableOptions, err = ParseTableOptions(req); err != nil {
+			h.writeError(w, req, err)
+			return
+		}
+	}
+	tableConvertor := h.tableConvertor
+	if wc.metadataOnly {
+		// 仅缓存了元数据，只能返回表格或 PartialObjectMetadata 格式的事件
+		if !servableFromMetadata(target, tableOptions) {
+			h.writeError(w, req, fmt.Errorf("%w: only metadata of %s is cached", errPassthrough, gvr.GroupResource()))
+			return
+		}
+		tableConvertor = registryrest.NewDefaultTableConvertor(gvr.GroupResource())
+	}
+	if fieldSelector, err = h.convertFieldSelector(wc, fieldSelector); err != nil {
+		h.writeError(w, req, err)
+		return
+	}
+	if opts.ResourceVersion == "" {
+		if err := h.waitForLatest(ctx, req, wc, gvr, info.Namespace); err != nil {
+			h.writeError(w, req, err)
+			return
+		}
+	}
+	// 检查字段选择器是否支持
+	for _, r := range fieldSelector.Requirements() {
+		if _, ok := wc.store.GetIndexers()[fieldIndexName(r.Field)]; !ok {
+			h.writeError(w, req, apierrors.NewBadRequest(fmt.Sprintf("field label not supported: %s", r.Field)))
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.writeError(w, req, fmt.Errorf("unable to start watch - can't get http.Flusher: %T", w))
+		return
+	}
+
+	var timeoutCh <-chan time.Time
+	if opts.TimeoutSeconds != nil && *opts.TimeoutSeconds > 0 {
+		timer := time.NewTimer(time.Duration(*opts.TimeoutSeconds) * time.Second)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	// 在写响应头前开始 watch ，缓存无法满足时（比如等待不到请求的资源版本）仍可直连
+	watcher, watchErr := wc.Watch(ctx, info.Namespace, opts)
+	if errors.Is(watchErr, errPassthrough) {
+		h.writeError(w, req, watchErr)
+		return
+	}
+
+	// 与 APIServer 一致，除 JSON 外的流式媒体类型带 stream=watch 参数
+	contentType := serializerInfo.MediaType
+	if contentType != runtime.ContentTypeJSON {
+		contentType += ";stream=watch"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ww := &watchEventWriter{
+		ctx:             ctx,
+		handler:         h,
+		encoder:         streaming.NewEncoder(serializerInfo.StreamSerializer.Framer.NewFrameWriter(w), serializerInfo.StreamSerializer.Serializer),
+		embeddedEncoder: serializerInfo.Serializer,
+		flusher:         flusher,
+		gvk:             gvk,
+		labelSelector:   labelSelector,
+		fieldSelector:   fieldSelector,
+		indexers:        wc.store.GetIndexers(),
+		tableConvertor:  tableConvertor,
+		tableOptions:    tableOptions,
+		target:          target,
+	}
+
+	if watchErr != nil {
+		// 与 APIServer 一致，开始 watch 后的错误以 ERROR 事件返回
+		_ = ww.writeError(watchErr)
+		return
+	}
+	defer watcher.Stop()
+
+	// 发送初始事件
+	for _, event := range watcher.InitEvents() {
+		if err := ww.write(event); err != nil {
+			logger.V(1).Info(fmt.Sprintf("write watch event error: %v", err))
+			return
+		}
+	}
+	if watcher.sendInitialEvents {
+		if err := ww.writeBookmark(watcher.initEventsEndRV, true); err != nil {
+			logger.V(1).Info(fmt.Sprintf("write watch event error: %v", err))
+			return
+		}
+	}
+
+	lastRV := watcher.initEventsEndRV
+	bookmarkTicker := time.NewTicker(watchBookmarkInterval)
+	defer bookmarkTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeoutCh:
+			return
+		case <-watcher.Done():
+			return
+		case <-bookmarkTicker.C:
+			if !opts.AllowWatchBookmarks {
+				continue
+			}
+			if rv := wc.ResourceVersion(); rv > lastRV {
+				lastRV = rv
+				if err := ww.writeBookmark(rv, false); err != nil {
+					logger.V(1).Info(fmt.Sprintf("write watch event error: %v", err))
+					return
+				}
+			}
+		case event := <-watcher.ResultChan():
+			lastRV = event.ResourceVersion
+			if err := ww.write(event); err != nil {
+				logger.V(1).Info(fmt.Sprintf("write watch event error: %v", err))
+				return
+			}
+		}
+	}
+}
+
+// watchEventWriter 将缓存事件过滤、转换后写到 watch 响应中
+type watchEventWriter struct {
+	ctx     context.Context
+	handler *CacheProxyHandler
+	// 事件编码器
+	encoder streaming.Encoder
+	// 事件中对象的编码器
+	embeddedEncoder runtime.Encoder
+	flusher         http.Flusher
+
+	gvk           schema.GroupVersionKind
+	labelSelector labels.Selector
+	fieldSelector fields.Selector
+	indexers      toolscache.Indexers
+
+	tableConvertor registryrest.TableConvertor
+	tableOptions   *metav1.TableOptions
+	// 协商得到的事件对象类型，为空时返回原始对象
+	target schema.GroupVersionKind
+}
+
+// write 写一个事件
+func (ww *watchEventWriter) write(event *watchCacheEvent) error {
+	eventType := event.Type
+	obj := event.Object
+
+	// 按选择器过滤，对象进出选择范围时分别转为 ADDED 和 DELETED 事件
+	matched := ww.matches(obj)
+	leftSelector := false
+	switch eventType {
+	case watch.Modified:
+		prevMatched := event.PrevObject != nil && ww.matches(event.PrevObject)
+		switch {
+		case matched && !prevMatched:
+			eventType = watch.Added
+		case !matched && prevMatched:
+			eventType = watch.Deleted
+			obj = event.PrevObject
+			leftSelector = true
+		case !matched && !prevMatched:
+			return nil
+		}
+	default:
+		if !matched {
+			return nil
+		}
+	}
+
+	if leftSelector {
+		// 离开选择范围的对象使用最新的资源版本，拷贝对象，避免修改缓存
+		obj = obj.DeepCopyObject()
+		if objMeta, err := meta.Accessor(obj); err == nil {
+			objMeta.SetResourceVersion(formatResourceVersion(event.ResourceVersion))
+		}
+	}
+	return ww.writeObject(eventType, obj)
+}
+
+// writeBookmark 写一个书签事件
+func (ww *watchEventWriter) writeBookmark(rv uint64, initialEventsEnd bool) error {
+	obj := ww.handler.newObject(ww.gvk, false)
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	objMeta.SetResourceVersion(formatResourceVersion(rv))
+	if initialEventsEnd {
+		objMeta.SetAnnotations(map[string]string{metav1.InitialEventsAnnotationKey: "true"})
+	}
+	switch ww.target.Kind {
+	case kindTable:
+		// 表格格式的 watch 书签对象为空表格
+		return ww.writeRaw(watch.Bookmark, &metav1.Table{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: ww.target.GroupVersion().String(),
+				Kind:       kindTable,
+			},
+			ListMeta: metav1.ListMeta{ResourceVersion: objMeta.GetResourceVersion()},
+		})
+	case kindPartialObjectMetadata:
+		partial, err := asPartialObjectMetadata(obj, ww.target.GroupVersion())
+		if err != nil {
+			return err
+		}
+		return ww.writeRaw(watch.Bookmark, partial)
+	}
+	return ww.writeRaw(watch.Bookmark, obj)
+}
+
+// writeError 写一个错误事件
+func (ww *watchEventWriter) writeError(err error) error {
+	status := apierrors.NewInternalError(err).Status()
+	if apiStatus, ok := err.(apierrors.APIStatus); ok {
+		status = apiStatus.Status()
+	}
+	status.APIVersion = "v1"
+	status.Kind = "Status"
+	return ww.writeRaw(watch.Error, &status)
+}
+
+// writeObject 写一个对象事件，需要时转换为请求的类型
+func (ww *watchEventWriter) writeObject(eventType watch.EventType, obj runtime.Object) error {
+	obj, err := transformResponseObject(ww.ctx, ww.tableConvertor, ww.tableOptions, obj, ww.target)
+	if err != nil {
+		return err
+	}
+	// 与 APIServer 一致，表格只在第一个事件中包含表头
+	if ww.tableOptions != nil && !ww.tableOptions.NoHeaders {
+		ww.tableOptions.NoHeaders = true
+	}
+	return ww.writeRaw(eventType, obj)
+}
+
+// writeRaw 编码并写一个事件
+func (ww *watchEventWriter) writeRaw(eventType watch.EventType, obj runtime.Object) error {
+	buf := &bytes.Buffer{}
+	if err := ww.embeddedEncoder.Encode(obj, buf); err != nil {
+		return err
+	}
+	if err := ww.encoder.Encode(&metav1.WatchEvent{
+		Type:   string(eventType),
+		Object: runtime.RawExtension{Raw: buf.Bytes()},
+	}); err != nil {
+		return err
+	}
+	ww.flusher.Flush()
+	return nil
+}
+
+// matches 判断对象是否匹配选择器
+func (ww *watchEventWriter) matches(obj runtime.Object) bool {
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	if !ww.labelSelector.Matches(labels.Set(objMeta.GetLabels())) {
+		return false
+	}
+	matched, err := matchFieldSelector(ww.indexers, obj, ww.fieldSelector)
+	return err == nil && matched
+}
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+)
+
+const (
+	// maxRecordedWriteResponseSize 记录写请求响应体的最大字节数，超过的响应不解析资源版本
+	maxRecordedWriteResponseSize = 1 << 20
+)
+
+// writeTracker 记录经代理转发的写请求返回的资源版本
+//
+// 之后读取对应资源时，等待缓存追上该资源版本，以保证能读到之前的写入（读己之写）
+type writeTracker struct {
+	lock sync.RWMutex
+	// 每次记录写入时递增的序号
+	seq    uint64
+	writes map[writeKey]trackedWrite
+}
+
+// writeKey 写入的资源和命名空间
+//
+// 同一资源的不同版本共享存储，因此不区分版本
+type writeKey struct {
+	gr schema.GroupResource
+	// 写入对象所在的命名空间，集群级别资源为空
+	namespace string
+}
+
+// trackedWrite 某资源某命名空间下记录的写入
+type trackedWrite struct {
+	// 写入返回的最大资源版本
+	rv uint64
+	// 最近一次写入的序号
+	seq uint64
+}
+
+// Seq 返回最近一次记录写入的序号
+//
+// 此后创建的缓存从 APIServer 列出的对象已包含该序号及之前的写入
+func (t *writeTracker) Seq() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.seq
+}
+
+// Observe 记录一次写请求返回的资源版本
+func (t *writeTracker) Observe(gr schema.GroupResource, namespace string, rv uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.writes == nil {
+		t.writes = make(map[writeKey]trackedWrite)
+	}
+	t.seq++
+	key := writeKey{gr: gr, namespace: namespace}
+	w := t.writes[key]
+	if rv > w.rv {
+		w.rv = rv
+	}
+	w.seq = t.seq
+	t.writes[key] = w
+}
+
+// ResourceVersion 返回指定资源在指定命名空间下序号 since 之后有写入时，写请求返回的最大资源版本，没有时返回 0
+//
+// namespace 为空时返回所有命名空间中的最大值
+func (t *writeTracker) ResourceVersion(gr schema.GroupResource, namespace string, since uint64) uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if namespace != "" {
+		w := t.writes[writeKey{gr: gr, namespace: namespace}]
+		if w.seq <= since {
+			return 0
+		}
+		return w.rv
+	}
+	var rv uint64
+	for key, w := range t.writes {
+		if key.gr == gr && w.seq > since && w.rv > rv {
+			rv = w.rv
+		}
+	}
+	return rv
+}
+
+// IsWrite 判断请求是否是针对某种资源的写请求
+func (h *CacheProxyHandler) IsWrite(req *http.Request) bool {
+	info, err := h.resolver.NewRequestInfo(req)
+	if err != nil || !info.IsResourceRequest || info.Resource == "" {
+		return false
+	}
+	switch info.Verb {
+	case "create", "update", "patch", "delete", "deletecollection":
+		return true
+	}
+	return false
+}
+
+// ServeWrite 将写请求转发到 APIServer ，并记录响应中的资源版本
+func (h *CacheProxyHandler) ServeWrite(w http.ResponseWriter, req *http.Request) {
+	logger := logr.FromContextOrDiscard(req.Context())
+
+	recorder := &writeResponseRecorder{
+		ResponseWriter: w,
+		// client-go 默认以 protobuf 编码内置资源
+		protobufDecoder: protobuf.NewSerializer(h.scheme, h.scheme),
+	}
+	h.passthrough.ServeHTTP(recorder, req)
+
+	info, err := h.resolver.NewRequestInfo(req)
+	if err != nil {
+		return
+	}
+	rv, ok := recorder.ResourceVersion()
+	if !ok {
+		return
+	}
+	// 子资源的写入同样改变资源本身
+	gr := schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}
+	logger.V(1).Info(fmt.Sprintf("observed write to %s in namespace %q at resource version %d", gr, info.Namespace, rv))
+	h.writes.Observe(gr, info.Namespace, rv)
+}
+
+// writeResponseRecorder 在写响应的同时记录响应状态码和响应体的 http.ResponseWriter
+type writeResponseRecorder struct {
+	http.ResponseWriter
+	// 用于解码 protobuf 响应，为空时仅支持 JSON 响应
+	protobufDecoder runtime.Decoder
+
+	code      int
+	body      bytes.Buffer
+	truncated bool
+}
+
+var _ http.ResponseWriter = &writeResponseRecorder{}
+
+// WriteHeader 写响应头
+func (r *writeResponseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write 写响应体
+func (r *writeResponseRecorder) Write(data []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	if !r.truncated {
+		if r.body.Len()+len(data) > maxRecordedWriteResponseSize {
+			r.truncated = true
+			r.body.Reset()
+		} else {
+			r.body.Write(data)
+		}
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Unwrap 返回被包装的 http.ResponseWriter ，用于 http.ResponseController
+func (r *writeResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// ResourceVersion 从成功的 JSON 或 protobuf 响应中解析 metadata.resourceVersion
+func (r *writeResponseRecorder) ResourceVersion() (uint64, bool) {
+	if r.code < 200 || r.code >= 300 || r.truncated {
+		return 0, false
+	}
+	header := r.Header()
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return 0, false
+	}
+
+	var body io.Reader = &r.body
+	if header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			return 0, false
+		}
+		defer func() { _ = gzipReader.Close() }()
+		body = gzipReader
+	}
+
+	var resourceVersion string
+	switch {
+	case mediaType == runtime.ContentTypeJSON:
+		obj := struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+		}{}
+		if err := json.NewDecoder(body).Decode(&obj); err != nil {
+			return 0, false
+		}
+		resourceVersion = obj.Metadata.ResourceVersion
+	case mediaType == runtime.ContentTypeProtobuf && r.protobufDecoder != nil:
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return 0, false
+		}
+		obj, _, err := r.protobufDecoder.Decode(data, nil, nil)
+		if err != nil {
+			return 0, false
+		}
+		objMeta, err := meta.Accessor(obj)
+		if err != nil {
+			return 0, false
+		}
+		resourceVersion = objMeta.GetResourceVersion()
+	default:
+		return 0, false
+	}
+
+	rv, err := parseResourceVersion(resourceVersion)
+	if err != nil || rv == 0 {
+		return 0, false
+	}
+	return rv, true
+}
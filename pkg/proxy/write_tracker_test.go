@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+)
+
+// TestWriteResponseRecorder 测试从写请求响应中解析资源版本
+func TestWriteResponseRecorder(t *testing.T) {
+	scheme := runtime.NewScheme()
+	AddKubernetesTypesToScheme(scheme)
+	protobufSerializer := protobuf.NewSerializer(scheme, scheme)
+	pod := newTestPod("default", "a", "42")
+	pod.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+	protobufPod := &bytes.Buffer{}
+	if err := protobufSerializer.Encode(pod, protobufPod); err != nil {
+		t.Fatalf("encode pod error: %v", err)
+	}
+
+	cases := []struct {
+		code        int
+		contentType string
+		body        string
+		rv          uint64
+		ok          bool
+	}{
+		{code: http.StatusOK, contentType: "application/json", body: `{"metadata":{"resourceVersion":"123"}}`, rv: 123, ok: true},
+		{code: http.StatusCreated, contentType: "application/json; charset=utf-8", body: `{"metadata":{"resourceVersion":"5"}}`, rv: 5, ok: true},
+		{code: http.StatusConflict, contentType: "application/json", body: `{"metadata":{"resourceVersion":"123"}}`},
+		{code: http.StatusOK, contentType: "application/json", body: `{"kind":"Status","status":"Success"}`},
+		{code: http.StatusOK, contentType: "application/vnd.kubernetes.protobuf", body: protobufPod.String(), rv: 42, ok: true},
+		{code: http.StatusOK, contentType: "application/vnd.kubernetes.protobuf", body: "k8s\x00"},
+		{code: http.StatusOK, contentType: "text/plain", body: "ok"},
+	}
+	for i, c := range cases {
+		recorder := &writeResponseRecorder{ResponseWriter: httptest.NewRecorder(), protobufDecoder: protobufSerializer}
+		recorder.Header().Set("Content-Type", c.contentType)
+		recorder.WriteHeader(c.code)
+		_, _ = recorder.Write([]byte(c.body))
+		rv, ok := recorder.ResourceVersion()
+		if rv != c.rv || ok != c.ok {
+			t.Errorf("case %d: expected (%d, %t), got: (%d, %t)", i, c.rv, c.ok, rv, ok)
+		}
+	}
+}
+
+// TestWriteTracker 测试按资源和命名空间记录写入的资源版本
+func TestWriteTracker(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	nodes := schema.GroupResource{Resource: "nodes"}
+
+	tracker := &writeTracker{}
+	tracker.Observe(pods, "a", 10)
+	tracker.Observe(pods, "a", 8)
+	since := tracker.Seq()
+	tracker.Observe(pods, "b", 20)
+	tracker.Observe(nodes, "", 30)
+
+	cases := []struct {
+		gr        schema.GroupResource
+		namespace string
+		since     uint64
+		rv        uint64
+	}{
+		{gr: pods, namespace: "a", rv: 10},
+		{gr: pods, namespace: "b", rv: 20},
+		{gr: pods, namespace: "c", rv: 0},
+		{gr: pods, namespace: "", rv: 20},
+		{gr: nodes, namespace: "", rv: 30},
+		// 缓存创建前的写入已包含在缓存中
+		{gr: pods, namespace: "a", since: since, rv: 0},
+		{gr: pods, namespace: "b", since: since, rv: 20},
+		{gr: pods, namespace: "", since: since, rv: 20},
+		{gr: pods, namespace: "", since: tracker.Seq(), rv: 0},
+	}
+	for i, c := range cases {
+		if rv := tracker.ResourceVersion(c.gr, c.namespace, c.since); rv != c.rv {
+			t.Errorf("case %d: expected %d, got: %d", i, c.rv, rv)
+		}
+	}
+}
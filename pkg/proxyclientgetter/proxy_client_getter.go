@@ -3,12 +3,14 @@ package proxyclientgetter
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"sync"
 
 	"github.com/go-logr/logr"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/rest"
 
+	"github.com/yhlooo/kubectl-cache/pkg/proxy"
 	"github.com/yhlooo/kubectl-cache/pkg/proxymgr"
 )
 
@@ -17,6 +19,8 @@ type ProxyClientGetter struct {
 	genericclioptions.RESTClientGetter
 
 	ProxyManager proxymgr.ProxyManager
+	// 是否要求代理一致性读
+	ConsistentRead bool
 
 	ctx context.Context
 
@@ -45,10 +49,10 @@ func (getter *ProxyClientGetter) ToRESTConfig() (*rest.Config, error) {
 	}
 
 	// 尝试获取正在运行的代理
-	proxy, err := getter.ProxyManager.GetForConfig(ctx, config)
-	if err != nil || proxy.Status.State != proxymgr.ProxyReady {
+	proxyObj, err := getter.ProxyManager.GetForConfig(ctx, config)
+	if err != nil || proxyObj.Status.State != proxymgr.ProxyReady {
 		// 没有的话新启动一个
-		proxy, err = getter.ProxyManager.NewForConfig(ctx, config)
+		proxyObj, err = getter.ProxyManager.NewForConfig(ctx, config)
 		if err != nil {
 			logger.Info(fmt.Sprintf("WARNING start cache proxy error, use passthrough mode, error: %v", err))
 			return config, nil
@@ -56,7 +60,30 @@ func (getter *ProxyClientGetter) ToRESTConfig() (*rest.Config, error) {
 	}
 
 	getter.logProxyAddrOnce.Do(func() {
-		logger.Info(fmt.Sprintf("using proxy http://127.0.0.1:%d", proxy.Status.Port))
+		logger.Info(fmt.Sprintf("using proxy http://127.0.0.1:%d", proxyObj.Status.Port))
 	})
-	return proxy.ToClientConfig(), nil
+	proxyConfig := proxyObj.ToClientConfig()
+	// 禁用压缩时也不要求代理压缩响应
+	proxyConfig.DisableCompression = config.DisableCompression
+	if getter.ConsistentRead {
+		// 通过请求头要求代理一致性读
+		proxyConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &consistentReadRoundTripper{rt: rt}
+		})
+	}
+	return proxyConfig, nil
+}
+
+// consistentReadRoundTripper 为请求添加一致性读请求头的 http.RoundTripper
+type consistentReadRoundTripper struct {
+	rt http.RoundTripper
+}
+
+var _ http.RoundTripper = &consistentReadRoundTripper{}
+
+// RoundTrip 执行单个 HTTP 事务
+func (rt *consistentReadRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(proxy.ConsistentReadHeader, "true")
+	return rt.rt.RoundTrip(req)
 }
@@ -9,8 +9,10 @@ import (
 )
 
 // GetConfigSignature 计算客户端配置签名
-func GetConfigSignature(config *rest.Config) string {
-	raw, _ := json.Marshal(map[string]interface{}{
+//
+// cacheArgs 为影响代理缓存行为且与默认值不同的命令行参数，为空时签名只由客户端配置决定，不为空时也参与签名计算
+func GetConfigSignature(config *rest.Config, cacheArgs []string) string {
+	fields := map[string]interface{}{
 		"Host":               config.Host,
 		"APIPath":            config.APIPath,
 		"Username":           config.Username,
@@ -29,7 +31,11 @@ func GetConfigSignature(config *rest.Config) string {
 		"AcceptContentTypes": config.AcceptContentTypes,
 		"ContentType":        config.ContentType,
 		"GroupVersion":       config.GroupVersion,
-	})
+	}
+	if len(cacheArgs) > 0 {
+		fields["CacheArgs"] = cacheArgs
+	}
+	raw, _ := json.Marshal(fields)
 	sum := sha256.Sum256(raw)
 	// NOTE: 只取前 4 个字节（ 8 个十六进制符号）是因为 UNIX Socket 地址长度不能超过 108 字节（ linux ）或 104 字节（ darwin ）
 	return hex.EncodeToString(sum[:4])
@@ -16,9 +16,24 @@ func TestGetConfigSignature(t *testing.T) {
 			KeyData:  []byte("test"),
 		},
 		BearerToken: "testtoken",
-	})
+	}, nil)
 	expected := "64b4a14ceeb9c31a4c3504358fb6e888d15e999bf23d77910f2a19822ded7f4b"
 	if ret != expected {
 		t.Errorf("expected: %s, got: %s", expected, ret)
 	}
 }
+
+// TestGetConfigSignatureWithCacheArgs 测试缓存参数参与签名计算
+func TestGetConfigSignatureWithCacheArgs(t *testing.T) {
+	config := &rest.Config{Host: "https://1.2.3.4", BearerToken: "testtoken"}
+	base := GetConfigSignature(config, nil)
+	withTTL := GetConfigSignature(config, []string{"--informer-idle-ttl", "10m0s"})
+	withMetadataOnly := GetConfigSignature(config, []string{"--informer-idle-ttl", "10m0s", "--metadata-only", "secrets"})
+
+	if withTTL == base || withMetadataOnly == withTTL {
+		t.Errorf("expected different signatures for different cache args, got: %s, %s, %s", base, withTTL, withMetadataOnly)
+	}
+	if again := GetConfigSignature(config, []string{"--informer-idle-ttl", "10m0s"}); again != withTTL {
+		t.Errorf("expected: %s, got: %s", withTTL, again)
+	}
+}
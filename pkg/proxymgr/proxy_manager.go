@@ -39,10 +39,13 @@ type ProxyManager interface {
 }
 
 // NewProxyManager 创建一个代理服务管理器
-func NewProxyManager(dataRoot string, startProxyArgs []string) ProxyManager {
+//
+// cacheArgs 为影响代理缓存行为的命令行参数，与客户端配置一起决定代理签名，参数不同的代理互不复用
+func NewProxyManager(dataRoot string, startProxyArgs []string, cacheArgs []string) ProxyManager {
 	return &defaultProxyManager{
 		dataRoot:       dataRoot,
 		startProxyArgs: startProxyArgs,
+		cacheArgs:      cacheArgs,
 	}
 }
 
@@ -56,6 +59,7 @@ const (
 type defaultProxyManager struct {
 	dataRoot       string
 	startProxyArgs []string
+	cacheArgs      []string
 }
 
 var _ ProxyManager = &defaultProxyManager{}
@@ -126,7 +130,7 @@ func (mgr *defaultProxyManager) Get(_ context.Context, name string) (*Proxy, err
 
 // GetForConfig 获取使用指定客户端配置的代理
 func (mgr *defaultProxyManager) GetForConfig(ctx context.Context, config *rest.Config) (*Proxy, error) {
-	return mgr.Get(ctx, GetConfigSignature(config))
+	return mgr.Get(ctx, GetConfigSignature(config, mgr.cacheArgs))
 }
 
 // NewForConfig 使用指定客户端配置创建一个代理
@@ -178,7 +182,7 @@ func (mgr *defaultProxyManager) LockProxy(_ context.Context, config *rest.Config
 		PID:                   os.Getpid(),
 		Port:                  0,
 		DataRoot:              "",
-		ClientConfigSignature: GetConfigSignature(config),
+		ClientConfigSignature: GetConfigSignature(config, mgr.cacheArgs),
 	}
 
 	// 创建数据目录
@@ -2,6 +2,8 @@ package cmdutil
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -53,7 +55,12 @@ func NewKubectlCommandWithInternalProxy(
 
 		// 注入上下文和代理管理器
 		proxyClientGetter.SetContext(ctx)
-		proxyClientGetter.ProxyManager = proxymgr.NewProxyManager(globalOpts.DataRoot, GetStartInternalProxyArgs(cmd))
+		proxyClientGetter.ProxyManager = proxymgr.NewProxyManager(
+			globalOpts.DataRoot,
+			GetStartInternalProxyArgs(cmd),
+			GetCacheArgs(globalOpts),
+		)
+		proxyClientGetter.ConsistentRead = globalOpts.ConsistentRead
 
 		if oldPreRunE != nil {
 			return oldPreRunE(cmd, args)
@@ -80,6 +87,7 @@ func NewKubectlCommandWithInternalProxy(
 			proxyClientGetter.ProxyManager = proxymgr.NewProxyManager(
 				globalOpts.DataRoot,
 				GetStartInternalProxyArgs(cmd),
+				GetCacheArgs(globalOpts),
 			)
 
 			return validArgsFunction(cmd, args, toComplete)
@@ -91,9 +99,9 @@ func NewKubectlCommandWithInternalProxy(
 
 // GetStartInternalProxyArgs 获取启动代理服务的命令行参数
 func GetStartInternalProxyArgs(cmd *cobra.Command) []string {
-	args := []string{"internal-proxy"}
-
 	globalOpts := options.GlobalOptionsFromContext(cmd.Context())
+	args := append([]string{"internal-proxy"}, GetCacheArgs(globalOpts)...)
+
 	if globalOpts.ClientConfig == nil {
 		return args
 	}
@@ -136,3 +144,44 @@ func GetStartInternalProxyArgs(cmd *cobra.Command) []string {
 
 	return args
 }
+
+// GetCacheArgs 获取影响代理缓存行为的命令行参数
+//
+// 这些参数参与代理签名的计算，参数不同时不复用已经运行的代理。
+// 只包含与默认值不同的参数，均为默认值时返回空，签名与不带缓存参数时一致
+func GetCacheArgs(globalOpts options.GlobalOptions) []string {
+	var args []string
+	if globalOpts.FieldIndexConfig != "" {
+		// 代理服务进程的工作目录可能不同，使用绝对路径
+		fieldIndexConfig := globalOpts.FieldIndexConfig
+		if absPath, err := filepath.Abs(fieldIndexConfig); err == nil {
+			fieldIndexConfig = absPath
+		}
+		args = append(args, "--field-index-config", fieldIndexConfig)
+	}
+	if len(globalOpts.MetadataOnlyResources) > 0 {
+		args = append(args, "--metadata-only", strings.Join(globalOpts.MetadataOnlyResources, ","))
+	}
+	if len(globalOpts.CacheNamespaces) > 0 {
+		args = append(args, "--cache-namespaces", strings.Join(globalOpts.CacheNamespaces, ","))
+	}
+	if globalOpts.InformerIdleTTL != options.DefaultInformerIdleTTL {
+		args = append(args, "--informer-idle-ttl", globalOpts.InformerIdleTTL.String())
+	}
+	if globalOpts.MaxCacheMemory != "" {
+		args = append(args, "--max-cache-memory", globalOpts.MaxCacheMemory)
+	}
+	if globalOpts.StripManagedFields {
+		args = append(args, "--strip-managed-fields")
+	}
+	if len(globalOpts.StripAnnotations) > 0 {
+		args = append(args, "--strip-annotations", strings.Join(globalOpts.StripAnnotations, ","))
+	}
+	if len(globalOpts.StripFields) > 0 {
+		args = append(args, "--strip-fields", strings.Join(globalOpts.StripFields, ","))
+	}
+	if globalOpts.PassthroughFullObjectGets {
+		args = append(args, "--passthrough-full-object-gets")
+	}
+	return args
+}